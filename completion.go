@@ -0,0 +1,98 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// commands are the commands offered by shell completion.
+var commands = []string{
+	"sync", "plan", "apply", "retry", "branch", "switch", "clean", "commit", "diff", "each-changed", "fmt", "freeze", "unfreeze", "init", "import", "list", "log", "migrate",
+	"open", "path", "pr", "push", "stashes", "unstash", "stats", "status", "watch", "ui", "undo-remove", "verify", "workspace", "completion",
+}
+
+// Managed repo paths are completed after these, using gitjoin __complete repos.
+var repoArgs = []string{"-paths", "--paths", "unstash", "open", "path", "freeze", "unfreeze"}
+
+// writeCompletion writes the completion script for shell to w.
+func writeCompletion(w io.Writer, shell string) error {
+	var script string
+	switch shell {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	case "powershell":
+		script = powershellCompletion
+	default:
+		return fmt.Errorf("unsupported shell %q, must be bash, zsh, fish or powershell", shell)
+	}
+	r := strings.NewReplacer(
+		"COMMANDS", strings.Join(commands, " "),
+		"REPOARGS_BASH", strings.Join(repoArgs, "|"),
+		"REPOARGS_PS", "'"+strings.Join(repoArgs, "', '")+"'",
+	)
+	_, err := io.WriteString(w, r.Replace(script))
+	return err
+}
+
+const bashCompletion = `_gitjoin() {
+	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+	if [ "$COMP_CWORD" -eq 1 ]; then
+		COMPREPLY=($(compgen -W "COMMANDS" -- "$cur"))
+		return
+	fi
+	case "$prev" in
+	REPOARGS_BASH)
+		COMPREPLY=($(compgen -W "$(gitjoin __complete repos 2>/dev/null)" -- "$cur"))
+		;;
+	esac
+}
+complete -o default -F _gitjoin gitjoin
+`
+
+const zshCompletion = `#compdef gitjoin
+_gitjoin() {
+	if (( CURRENT == 2 )); then
+		compadd -- COMMANDS
+		return
+	fi
+	case ${words[CURRENT-1]} in
+	REPOARGS_BASH)
+		compadd -- ${(f)"$(gitjoin __complete repos 2>/dev/null)"}
+		;;
+	*)
+		_files
+		;;
+	esac
+}
+compdef _gitjoin gitjoin
+`
+
+const fishCompletion = `complete -c gitjoin -n __fish_use_subcommand -f -a "COMMANDS"
+complete -c gitjoin -n "__fish_seen_subcommand_from unstash open path freeze unfreeze" -f -a "(gitjoin __complete repos 2>/dev/null)"
+complete -c gitjoin -o paths -x -a "(gitjoin __complete repos 2>/dev/null)"
+`
+
+const powershellCompletion = `Register-ArgumentCompleter -Native -CommandName gitjoin -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+	$words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+	if ($wordToComplete -ne '') { $words = $words[0..($words.Count - 2)] }
+	if ($words.Count -eq 1) {
+		$candidates = 'COMMANDS' -split ' '
+	} elseif ($words[-1] -in REPOARGS_PS) {
+		$candidates = @(gitjoin __complete repos 2>$null)
+	} else {
+		return
+	}
+	$candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+		[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+	}
+}
+`
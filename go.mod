@@ -4,7 +4,10 @@ go 1.24.0
 
 require (
 	github.com/bep/helpers v0.7.0
+	github.com/bmatcuk/doublestar/v4 v4.10.0
+	github.com/pelletier/go-toml/v2 v2.2.4
 	github.com/rogpeppe/go-internal v1.14.1
+	golang.org/x/term v0.39.0
 )
 
 require (
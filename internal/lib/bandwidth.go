@@ -0,0 +1,287 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// throttle points git to a proxy on localhost that limits the total
+// throughput of clones and fetches over HTTP(S) to Config.MaxBandwidth,
+// until the returned func is called. The proxy passes the traffic on to
+// the proxy git would have used for the remote, if any.
+func (s *Syncer) throttle() (func(), error) {
+	repo := s.repo("")
+	// Proxies set for a URL would bypass the throttle.
+	out, _ := repo.run("config", "--get-regexp", `^http\.(.+\.)?proxy$`)
+	keys := []string{"http.proxy"}
+	for line := range strings.Lines(out) {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if _, err := parseProxy(value); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		keys = append(keys, key)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &throttleProxy{
+		limiter:  s.Cfg.limiter,
+		upstream: make(map[string]*url.URL),
+		lookup: func(u *url.URL) (*url.URL, error) {
+			out, err := repo.run("config", "--get-urlmatch", "http.proxy", u.String()+"/")
+			if err != nil {
+				// Not set in the git config.
+				return http.ProxyFromEnvironment(&http.Request{URL: u})
+			}
+			return parseProxy(strings.TrimSpace(out))
+		},
+	}
+	p.tr = &http.Transport{Proxy: func(r *http.Request) (*url.URL, error) {
+		return p.proxy(r.URL.Scheme, r.URL.Host)
+	}}
+	go http.Serve(ln, p)
+
+	gitArgs := s.Cfg.GitArgs
+	var args []string
+	for _, key := range keys {
+		args = append(args, "-c", key+"=http://"+ln.Addr().String())
+	}
+	s.Cfg.GitArgs = append(slices.Clone(gitArgs), args...)
+	var refsArgs []string
+	if s.refs != nil {
+		refsArgs = s.refs.repo.gitArgs
+		s.refs.repo.gitArgs = append(slices.Clone(refsArgs), args...)
+	}
+	return func() {
+		s.Cfg.GitArgs = gitArgs
+		if s.refs != nil {
+			s.refs.repo.gitArgs = refsArgs
+		}
+		ln.Close()
+	}, nil
+}
+
+// sshRepos returns the repos, sorted, that are cloned over SSH and so
+// bypass the throttle.
+func (s *Syncer) sshRepos(repos map[string]entry) []string {
+	var ssh []string
+	for localPath, e := range repos {
+		if isSSHURL(s.ws.rewriteURL(repoPathToURL(e.Repo, e.protocol()))) {
+			ssh = append(ssh, localPath)
+		}
+	}
+	slices.Sort(ssh)
+	return ssh
+}
+
+// parseProxy parses a proxy as set in the git config,
+// [scheme://][user[:password]@]host[:port], returning nil for "", which
+// is no proxy.
+func parseProxy(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%s proxies can't be used with -max-bandwidth", u.Scheme)
+	}
+	if u.Port() == "" {
+		// git's default.
+		u.Host = net.JoinHostPort(u.Hostname(), "1080")
+	}
+	return u, nil
+}
+
+type throttleProxy struct {
+	*limiter
+	tr *http.Transport
+
+	mu       sync.Mutex
+	upstream map[string]*url.URL // by scheme://host
+	lookup   func(u *url.URL) (*url.URL, error)
+}
+
+// proxy returns the proxy to pass requests to scheme://host on to, nil
+// if they go directly.
+func (p *throttleProxy) proxy(scheme, host string) (*url.URL, error) {
+	// As git sees the URL, without the default port.
+	u := &url.URL{Scheme: scheme, Host: strings.TrimSuffix(host, map[string]string{"http": ":80", "https": ":443"}[scheme])}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if proxy, found := p.upstream[u.String()]; found {
+		return proxy, nil
+	}
+	proxy, err := p.lookup(u)
+	if err != nil {
+		return nil, err
+	}
+	p.upstream[u.String()] = proxy
+	return proxy, nil
+}
+
+func (p *throttleProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		p.forward(w, r)
+		return
+	}
+	dst, err := p.dial(r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		dst.Close()
+		return
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		conn.Close()
+		dst.Close()
+		return
+	}
+	go func() {
+		io.Copy(dst, p.reader(brw))
+		dst.Close()
+	}()
+	io.Copy(conn, p.reader(dst))
+	conn.Close()
+}
+
+// dial opens a tunnel to addr, through the upstream proxy if there is one.
+func (p *throttleProxy) dial(addr string) (net.Conn, error) {
+	proxy, err := p.proxy("https", addr)
+	if err != nil {
+		return nil, err
+	}
+	if proxy == nil {
+		return net.DialTimeout("tcp", addr, 30*time.Second)
+	}
+	if proxy.Scheme != "http" && proxy.Scheme != "https" {
+		return nil, fmt.Errorf("%s proxies can't be used with -max-bandwidth", proxy.Scheme)
+	}
+	proxyAddr := proxy.Host
+	if proxy.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxy.Hostname(), map[string]string{"http": "80", "https": "443"}[proxy.Scheme])
+	}
+	conn, err := net.DialTimeout("tcp", proxyAddr, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if proxy.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: proxy.Hostname()})
+	}
+	req := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: addr}, Host: addr, Header: make(http.Header)}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(proxy.User.Username()+":"+password)))
+	}
+	br := bufio.NewReader(conn)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %s", proxy.Redacted(), resp.Status)
+	}
+	return bufferedConn{conn, br}, nil
+}
+
+// bufferedConn reads what's left in r before reading from the Conn.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// forward proxies a plain http request.
+func (p *throttleProxy) forward(w http.ResponseWriter, r *http.Request) {
+	r.RequestURI = ""
+	r.Header.Del("Proxy-Connection")
+	r.Header.Add("Via", "1.1 gitjoin")
+	if r.Body != nil {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{p.reader(r.Body), r.Body}
+	}
+	resp, err := p.tr.RoundTrip(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, p.reader(resp.Body))
+}
+
+// limiter spreads the bytes read through it evenly over time, at most
+// rate bytes per second in total.
+type limiter struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time // when the next byte may be read
+}
+
+func (l *limiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	d := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	l.mu.Unlock()
+	time.Sleep(d)
+}
+
+func (l *limiter) reader(r io.Reader) io.Reader {
+	return throttledReader{r: r, l: l}
+}
+
+type throttledReader struct {
+	r io.Reader
+	l *limiter
+}
+
+func (t throttledReader) Read(b []byte) (int, error) {
+	// Small reads keep the throughput smooth.
+	if len(b) > 16<<10 {
+		b = b[:16<<10]
+	}
+	n, err := t.r.Read(b)
+	t.l.wait(n)
+	return n, err
+}
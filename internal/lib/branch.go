@@ -0,0 +1,137 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// CreateBranch creates and switches to branch in all managed repos.
+func CreateBranch(cfg Config, branch string) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+
+	var (
+		mu               sync.Mutex
+		created, skipped []RepoResult
+	)
+	err = s.forEachRepo(slices.Collect(maps.Keys(expected)), func(localPath string) error {
+		repo := s.repo(localPath)
+		if expected[localPath].has("off") || !repo.IsGitRepo() {
+			return nil
+		}
+		if repo.HasBranch(branch) {
+			mu.Lock()
+			skipped = append(skipped, RepoResult{Path: localPath})
+			mu.Unlock()
+			return nil
+		}
+		if err := repo.CreateBranch(branch); err != nil {
+			return fmt.Errorf("%s: create branch: %w", localPath, err)
+		}
+		mu.Lock()
+		created = append(created, RepoResult{Path: localPath})
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	byPath := func(a, b RepoResult) int { return strings.Compare(a.Path, b.Path) }
+	slices.SortFunc(created, byPath)
+	slices.SortFunc(skipped, byPath)
+	s.printSections(
+		section{colorGreen, "Created " + branch, created},
+		section{colorYellow, "Skipped (branch exists)", skipped},
+	)
+	return nil
+}
+
+// Switch switches all managed repos to branch, or to their default branch
+// if branch is "default". Repos with uncommitted changes or without the
+// branch are skipped.
+func Switch(cfg Config, branch string) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+
+	var (
+		mu                        sync.Mutex
+		switched, dirty, notFound []RepoResult
+	)
+	add := func(results *[]RepoResult, r RepoResult) {
+		mu.Lock()
+		*results = append(*results, r)
+		mu.Unlock()
+	}
+	err = s.forEachRepo(slices.Collect(maps.Keys(expected)), func(localPath string) error {
+		repo := s.repo(localPath)
+		if expected[localPath].has("off") || !repo.IsGitRepo() {
+			return nil
+		}
+		target := branch
+		if target == "default" {
+			defaultBranch, err := repo.DefaultBranch()
+			if err != nil {
+				return fmt.Errorf("%s: get default branch: %w", localPath, err)
+			}
+			target = defaultBranch
+		}
+		st, err := repo.Status()
+		if err != nil {
+			return fmt.Errorf("%s: status: %w", localPath, err)
+		}
+		current := st.Branch
+		if current == target {
+			return nil
+		}
+		if !repo.HasBranch(target) && !repo.HasRemoteBranch(target) {
+			add(&notFound, RepoResult{Path: localPath})
+			return nil
+		}
+		if st.dirty() {
+			add(&dirty, RepoResult{Path: localPath, Detail: st.summary()})
+			return nil
+		}
+		if err := repo.SwitchBranch(target); err != nil {
+			return fmt.Errorf("%s: switch branch: %w", localPath, err)
+		}
+		detail := target
+		if current != "" {
+			detail += " from " + current
+		}
+		add(&switched, RepoResult{Path: localPath, Detail: detail})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	byPath := func(a, b RepoResult) int { return strings.Compare(a.Path, b.Path) }
+	slices.SortFunc(switched, byPath)
+	slices.SortFunc(dirty, byPath)
+	slices.SortFunc(notFound, byPath)
+	s.printSections(
+		section{colorGreen, "Switched", switched},
+		section{colorYellow, "Skipped (" + reasonUncommitted + ")", dirty},
+		section{colorYellow, "Skipped (no such branch)", notFound},
+	)
+	return nil
+}
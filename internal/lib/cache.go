@@ -0,0 +1,144 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const cacheFile = ".gitjoin/cache.json"
+
+// metaCache caches repo metadata that rarely changes, e.g. the default
+// branch. An entry is invalidated when the file git stores the value in
+// is modified.
+type metaCache struct {
+	mu      sync.Mutex
+	Repos   map[string]map[string]cacheEntry // repo path -> key -> entry
+	Index   map[string]string                // local path -> repo path of the managed repos
+	States  map[string]repoState             // local path -> state after the last sync
+	changed bool
+}
+
+// repoState is the state of a repo after a sync and what the sync
+// reported for it, reused while the repo and its remote are unchanged.
+type repoState struct {
+	Fingerprint string
+	Skip        *SkippedRepo `json:",omitempty"`
+	Fetched     time.Time    // when origin was last fetched
+}
+
+type cacheEntry struct {
+	Value   string
+	ModTime time.Time
+}
+
+// loadCache loads the cache from root. A missing or broken cache file
+// gives an empty cache.
+func loadCache(root string) *metaCache {
+	c := &metaCache{}
+	if b, err := os.ReadFile(filepath.Join(root, cacheFile)); err == nil {
+		json.Unmarshal(b, c)
+	}
+	if c.Repos == nil {
+		c.Repos = make(map[string]map[string]cacheEntry)
+	}
+	return c
+}
+
+func (c *metaCache) save(root string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.changed {
+		return nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(root, cacheFile)
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filename, b, 0o644); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
+
+// setIndex saves the managed repos for quick lookups, e.g. by gitjoin path.
+func (c *metaCache) setIndex(expected map[string]entry) {
+	index := repoIndex(expected)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !maps.Equal(c.Index, index) {
+		c.Index = index
+		c.changed = true
+	}
+}
+
+// get returns the cached value for key in repoPath if file hasn't been
+// modified since it was cached, else the value returned by load.
+// A nil cache always loads.
+func (c *metaCache) get(repoPath, key, file string, load func() (string, error)) (string, error) {
+	if c == nil {
+		return load()
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		return load()
+	}
+	c.mu.Lock()
+	e, found := c.Repos[repoPath][key]
+	c.mu.Unlock()
+	if found && e.ModTime.Equal(fi.ModTime()) {
+		return e.Value, nil
+	}
+	v, err := load()
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Repos[repoPath] == nil {
+		c.Repos[repoPath] = make(map[string]cacheEntry)
+	}
+	c.Repos[repoPath][key] = cacheEntry{Value: v, ModTime: fi.ModTime()}
+	c.changed = true
+	return v, nil
+}
+
+func (c *metaCache) state(localPath string) (repoState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, found := c.States[localPath]
+	return st, found
+}
+
+func (c *metaCache) setState(localPath string, st repoState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.States == nil {
+		c.States = make(map[string]repoState)
+	}
+	c.States[localPath] = st
+	c.changed = true
+}
+
+// pruneStates removes the states of repos no longer managed.
+func (c *metaCache) pruneStates(expected map[string]entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for localPath := range c.States {
+		if _, found := expected[localPath]; !found {
+			delete(c.States, localPath)
+			c.changed = true
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+type CleanOptions struct {
+	X   bool // also remove ignored files
+	Yes bool // skip the confirmation prompt
+}
+
+// Clean runs git clean in all managed repos not annotated with noclean.
+func Clean(cfg Config, opts CleanOptions) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+
+	args := []string{"clean", "-d"}
+	if opts.X {
+		args = append(args, "-x")
+	}
+
+	var repos []string
+	for _, localPath := range slices.Sorted(maps.Keys(expected)) {
+		if expected[localPath].has("noclean") {
+			continue
+		}
+		repo := s.repo(localPath)
+		if !repo.IsGitRepo() {
+			continue
+		}
+		out, err := repo.run(append(args, "-n")...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", localPath, err)
+		}
+		out = strings.TrimSpace(out)
+		if out == "" {
+			continue
+		}
+		s.log("%s:\n", localPath)
+		for line := range strings.SplitSeq(out, "\n") {
+			s.log("  %s\n", line)
+		}
+		repos = append(repos, localPath)
+	}
+
+	if len(repos) == 0 {
+		return nil
+	}
+
+	if !opts.Yes {
+		s.log("Clean %d repos? [y/N] ", len(repos))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			s.log("Aborted\n")
+			return nil
+		}
+	}
+
+	for _, localPath := range repos {
+		repo := s.repo(localPath)
+		if _, err := repo.run(append(args, "-f")...); err != nil {
+			return fmt.Errorf("%s: %w", localPath, err)
+		}
+	}
+	s.log("Cleaned: %d repos\n", len(repos))
+	return nil
+}
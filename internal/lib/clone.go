@@ -0,0 +1,59 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stagingDir is where repos are cloned before they're moved into place,
+// so an interrupted clone never leaves a broken repo in the tree.
+const stagingDir = ".gitjoin/clones"
+
+// stagingPath returns the directory localPath is cloned into.
+func (s *Syncer) stagingPath(localPath string) string {
+	return filepath.Join(s.Cfg.Root, stagingDir, url.PathEscape(localPath))
+}
+
+// cleanStaging removes the interrupted clones of repos not in expected.
+func (s *Syncer) cleanStaging(expected map[string]entry) error {
+	dirs, err := os.ReadDir(filepath.Join(s.Cfg.Root, stagingDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, d := range dirs {
+		localPath, err := url.PathUnescape(d.Name())
+		if _, found := expected[localPath]; err == nil && found {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.Cfg.Root, stagingDir, d.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resumeClone completes an interrupted clone: it fetches what's missing
+// from origin and checks out the default branch.
+func (r Repo) resumeClone(args []string) error {
+	if _, err := r.run(append([]string{"fetch", "origin"}, args...)...); err != nil {
+		return err
+	}
+	if _, err := r.run("remote", "set-head", "origin", "--auto"); err != nil {
+		return err
+	}
+	out, err := r.run("symbolic-ref", "--short", "refs/remotes/origin/HEAD")
+	if err != nil {
+		return err
+	}
+	upstream := strings.TrimSpace(out)
+	_, err = r.run("checkout", "-B", strings.TrimPrefix(upstream, "origin/"), "--track", upstream)
+	return err
+}
@@ -0,0 +1,106 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type CommitOptions struct {
+	Message string
+	All     bool // also commit untracked files
+}
+
+// Commit commits the changes in all dirty managed repos with the same message.
+// Repos with a detached HEAD are skipped, and repos that fail are reported
+// without stopping the others.
+func Commit(cfg Config, opts CommitOptions) error {
+	if opts.Message == "" {
+		return errors.New("commit message required (-m)")
+	}
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+
+	var (
+		mu                                    sync.Mutex
+		committed, detached, readonly, failed []RepoResult
+	)
+	add := func(results *[]RepoResult, r RepoResult) {
+		mu.Lock()
+		*results = append(*results, r)
+		mu.Unlock()
+	}
+	err = s.forEachRepo(slices.Collect(maps.Keys(expected)), func(localPath string) error {
+		repo := s.repo(localPath)
+		if expected[localPath].has("off") || !repo.IsGitRepo() {
+			return nil
+		}
+		fail := func(stage string, err error) error {
+			add(&failed, RepoResult{Path: localPath, Detail: stage + ": " + strings.Join(strings.Fields(err.Error()), " ")})
+			return nil
+		}
+		hasChanges := repo.HasTrackedChanges
+		if opts.All {
+			hasChanges = repo.HasUncommittedChanges
+		}
+		dirty, err := hasChanges()
+		if err != nil {
+			return fail("check uncommitted changes", err)
+		}
+		if !dirty {
+			return nil
+		}
+		if expected[localPath].has("readonly") {
+			add(&readonly, RepoResult{Path: localPath})
+			return nil
+		}
+		branch, err := repo.CurrentBranch()
+		if err != nil {
+			return fail("get current branch", err)
+		}
+		if branch == "" {
+			add(&detached, RepoResult{Path: localPath})
+			return nil
+		}
+		if err := repo.Commit(opts.Message, opts.All); err != nil {
+			return fail("commit", err)
+		}
+		stat, err := repo.run("show", "--shortstat", "--format=", "HEAD")
+		if err != nil {
+			return fail("show", err)
+		}
+		add(&committed, RepoResult{Path: localPath, Detail: branch + ", " + strings.TrimSpace(stat)})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	byPath := func(a, b RepoResult) int { return strings.Compare(a.Path, b.Path) }
+	slices.SortFunc(committed, byPath)
+	slices.SortFunc(detached, byPath)
+	slices.SortFunc(readonly, byPath)
+	slices.SortFunc(failed, byPath)
+	s.printSections(
+		section{colorGreen, "Committed", committed},
+		section{colorYellow, "Skipped (detached HEAD)", detached},
+		section{colorYellow, "Skipped (read-only)", readonly},
+		section{colorRed, "Failed", failed},
+	)
+	if len(failed) > 0 {
+		return fmt.Errorf("%d commits failed", len(failed))
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// withCredentials sets up git to use c.Tokens for their hosts instead of
+// the user's credential helpers. The tokens are passed in the environment
+// so they don't show up in the process list.
+func (c Config) withCredentials() (Config, error) {
+	if len(c.Tokens) == 0 {
+		return c, nil
+	}
+	args, env := slices.Clone(c.GitArgs), slices.Clone(c.gitEnv)
+	for i, t := range c.Tokens {
+		host, token, ok := strings.Cut(t, "=")
+		if !ok {
+			host, token = "github.com", t
+		}
+		if host == "" || token == "" {
+			return c, fmt.Errorf("invalid -token for host %q, must be HOST=TOKEN or TOKEN", host)
+		}
+		name := fmt.Sprintf("GITJOIN_CREDENTIAL_%d", i)
+		helper := `!f() { test "$1" = get && echo username=x-access-token && echo "password=$` + name + `"; }; f`
+		for _, scheme := range []string{"https", "http"} {
+			key := "credential." + scheme + "://" + host + ".helper"
+			// The empty value drops the helpers configured so far.
+			args = append(args, "-c", key+"=", "-c", key+"="+helper)
+		}
+		env = append(env, name+"="+token)
+	}
+	c.GitArgs, c.gitEnv = args, env
+	return c, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+type DiffOptions struct {
+	Stat bool // print a diffstat instead of the patch
+}
+
+// Diff prints the uncommitted changes in all dirty managed repos to stdout.
+func Diff(cfg Config, opts DiffOptions) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	s.color = useColor(cfg.Color, s.stdout)
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+
+	first := true
+	for _, localPath := range slices.Sorted(maps.Keys(expected)) {
+		repo := s.repo(localPath)
+		if !repo.IsGitRepo() {
+			continue
+		}
+		st, err := repo.Status()
+		if err != nil {
+			return fmt.Errorf("%s: %w", localPath, err)
+		}
+		if !st.dirty() {
+			continue
+		}
+		diff, err := repo.Diff(opts.Stat, s.color)
+		if err != nil {
+			return fmt.Errorf("%s: %w", localPath, err)
+		}
+		if !first {
+			fmt.Fprintln(s.stdout)
+		}
+		first = false
+		fmt.Fprintf(s.stdout, "%s\n%s", s.colorize(colorYellow, fmt.Sprintf("==> %s (%s)", localPath, st.summary())), diff)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// EachChanged runs command with sh in each repo whose HEAD was moved by
+// the last sync, i.e. that was cloned or had commits pulled, one repo at
+// a time.
+func EachChanged(cfg Config, command string) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	s.color = useColor(cfg.Color, s.stdout)
+	runs, err := loadHistory(cfg.Root)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		return errors.New("no sync recorded yet")
+	}
+	last := runs[len(runs)-1]
+	var paths []string
+	for _, r := range last.Cloned {
+		paths = append(paths, r.Path)
+	}
+	for _, r := range last.Updated {
+		if r.Commits > 0 {
+			paths = append(paths, r.Path)
+		}
+	}
+	slices.Sort(paths)
+
+	var failed []string
+	for _, localPath := range paths {
+		dir := filepath.Join(s.Cfg.Root, localPath)
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		fmt.Fprintln(s.stdout, s.colorize(colorYellow, "==> "+localPath))
+		cmd := shellCommand(command)
+		cmd.Dir, cmd.Stdin, cmd.Stdout, cmd.Stderr = dir, os.Stdin, s.stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			failed = append(failed, localPath)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("command failed in %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
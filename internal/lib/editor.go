@@ -0,0 +1,91 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	codeWorkspaceFile  = "gitjoin.code-workspace"
+	codeWorkspaceStart = "// Managed by gitjoin - do not edit this section"
+	codeWorkspaceEnd   = "// End gitjoin managed section"
+)
+
+// EditorWorkspace sets up an editor workspace with the managed repos. For
+// vscode, it creates or updates gitjoin.code-workspace in the root, which
+// is then kept up to date by every sync. Zed has no workspace files, so
+// for zed it prints the command that opens all the repos.
+func EditorWorkspace(cfg Config, format string) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	managed, err := s.collectAllRepos()
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "vscode":
+		return s.updateCodeWorkspace(managed, true)
+	case "zed":
+		paths := slices.Sorted(maps.Keys(managed))
+		_, err := fmt.Fprintln(s.stdout, "zed", strings.Join(paths, " "))
+		return err
+	}
+	return fmt.Errorf("invalid -format %q, must be vscode or zed", format)
+}
+
+// updateCodeWorkspace writes the managed block listing the repos to the
+// folders of gitjoin.code-workspace. Unless create is set, a missing file
+// is left missing.
+func (s *Syncer) updateCodeWorkspace(managed map[string]entry, create bool) error {
+	filename := filepath.Join(s.Cfg.Root, codeWorkspaceFile)
+	existing, err := os.ReadFile(filename)
+	if os.IsNotExist(err) && !create {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var block strings.Builder
+	block.WriteString("\t\t" + codeWorkspaceStart + "\n")
+	for _, localPath := range slices.Sorted(maps.Keys(managed)) {
+		path, err := json.Marshal(filepath.ToSlash(localPath))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&block, "\t\t{\"path\": %s},\n", path)
+	}
+	block.WriteString("\t\t" + codeWorkspaceEnd + "\n")
+
+	content := string(existing)
+	newContent, found := replaceBlock(content, codeWorkspaceStart, codeWorkspaceEnd, block.String())
+	switch {
+	case len(existing) == 0:
+		newContent = "{\n\t\"folders\": [\n" + block.String() + "\t],\n\t\"settings\": {}\n}\n"
+	case !found:
+		// The workspace is JSON with comments and trailing commas, so the
+		// block can go first in the list.
+		_, after, ok := strings.Cut(content, `"folders": [`)
+		rest, _, _ := strings.Cut(after, "\n")
+		if !ok || strings.TrimSpace(rest) != "" {
+			return errors.New(`no "folders" list to add the repos to`)
+		}
+		i := len(content) - len(after) + len(rest) + 1
+		newContent = content[:i] + block.String() + content[i:]
+	}
+	if newContent == content {
+		return nil
+	}
+	return writeFileAtomic(filename, []byte(newContent), 0o644)
+}
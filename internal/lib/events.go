@@ -0,0 +1,98 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import "sync"
+
+// Events receives the outcome for each repo as it's processed, e.g. to
+// report progress. The methods may be called concurrently.
+type Events interface {
+	OnClone(RepoResult)
+	OnPull(RepoResult)
+	OnSkip(SkippedRepo)
+	OnRemove(path string)
+	OnFail(FailedRepo)
+}
+
+// collector collects events into the Result the CLI prints its summary
+// from, passing them on to the Events in Config, if set.
+type collector struct {
+	mu     sync.Mutex
+	result Result
+	next   Events
+
+	// unreachable is the number of repos in a row that failed to reach
+	// their remote.
+	unreachable int
+}
+
+func (s *Syncer) newCollector() *collector {
+	return &collector{next: s.Cfg.Events}
+}
+
+func (c *collector) OnClone(r RepoResult) {
+	c.mu.Lock()
+	c.result.Cloned = append(c.result.Cloned, r)
+	c.mu.Unlock()
+	if c.next != nil {
+		c.next.OnClone(r)
+	}
+}
+
+func (c *collector) OnPull(r RepoResult) {
+	c.mu.Lock()
+	c.result.Updated = append(c.result.Updated, r)
+	c.mu.Unlock()
+	if c.next != nil {
+		c.next.OnPull(r)
+	}
+}
+
+func (c *collector) OnSkip(r SkippedRepo) {
+	c.mu.Lock()
+	c.result.Skipped = append(c.result.Skipped, r)
+	c.mu.Unlock()
+	if c.next != nil {
+		c.next.OnSkip(r)
+	}
+}
+
+func (c *collector) OnRemove(path string) {
+	c.mu.Lock()
+	c.result.Removed = append(c.result.Removed, path)
+	c.mu.Unlock()
+	if c.next != nil {
+		c.next.OnRemove(path)
+	}
+}
+
+func (c *collector) OnFail(r FailedRepo) {
+	c.mu.Lock()
+	c.result.Failed = append(c.result.Failed, r)
+	c.mu.Unlock()
+	if c.next != nil {
+		c.next.OnFail(r)
+	}
+}
+
+// onProcessed records a processed repo and returns the number of repos in
+// a row that failed to reach their remote.
+func (c *collector) onProcessed(stats *repoStats) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result.Repos++
+	c.result.Received += stats.received
+	if stats.unreachable == "" {
+		c.unreachable = 0
+	} else {
+		c.unreachable++
+	}
+	return c.unreachable
+}
+
+func (c *collector) onTiming(t Timing) {
+	c.mu.Lock()
+	c.result.Timings = append(c.result.Timings, t)
+	c.mu.Unlock()
+}
@@ -0,0 +1,119 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recorder records the events as "OnClone ws/foo" etc.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event, path string) {
+	r.mu.Lock()
+	r.events = append(r.events, event+" "+path)
+	r.mu.Unlock()
+}
+
+func (r *recorder) OnClone(rr RepoResult) { r.add("OnClone", rr.Path) }
+func (r *recorder) OnPull(rr RepoResult)  { r.add("OnPull", rr.Path) }
+func (r *recorder) OnSkip(sr SkippedRepo) { r.add("OnSkip", sr.Path) }
+func (r *recorder) OnRemove(path string)  { r.add("OnRemove", path) }
+func (r *recorder) OnFail(fr FailedRepo)  { r.add("OnFail", fr.Path) }
+
+func (r *recorder) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	slices.Sort(events)
+	return events
+}
+
+func TestEvents(t *testing.T) {
+	dir := t.TempDir()
+	gitconfig := filepath.Join(dir, ".gitconfig")
+	if err := os.WriteFile(gitconfig, []byte("[user]\n\tname = gitjoin\n\temail = gitjoin@example.com\n[init]\n\tdefaultBranch = main\n[protocol \"file\"]\n\tallow = always\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", gitconfig)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GITHUB_ACTIONS", "")
+	git := func(args ...string) {
+		t.Helper()
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	commit := func(name, text string) {
+		t.Helper()
+		src := filepath.Join(dir, "src", name)
+		if err := os.MkdirAll(src, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, "README.md"), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		git("-C", src, "init", "-q")
+		git("-C", src, "add", "README.md")
+		git("-C", src, "commit", "-qm", text)
+	}
+	remote := func(name string) string {
+		return filepath.ToSlash(filepath.Join(dir, "remotes", name))
+	}
+	for _, name := range []string{"foo", "bar"} {
+		commit(name, name)
+		git("clone", "-q", "--bare", filepath.Join(dir, "src", name), remote(name)+".git")
+	}
+
+	root := filepath.Join(dir, "root")
+	manifest := filepath.Join(root, "gitjoin.txt")
+	writeManifest := func(names ...string) {
+		t.Helper()
+		var b strings.Builder
+		for _, name := range names {
+			b.WriteString(remote(name) + " protocol=file\n")
+		}
+		if err := os.WriteFile(manifest, []byte(b.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	git("clone", "-q", remote("foo")+".git", filepath.Join(root, "old"))
+	writeManifest("foo", "bar", "missing")
+
+	events := &recorder{}
+	cfg := Config{Root: root, Quiet: true, AllowInsecure: true, Events: events}
+	if err := Sync(cfg); err == nil {
+		t.Fatal("expected the missing repo to fail the sync")
+	}
+	want := []string{"OnClone bar", "OnClone foo", "OnFail missing", "OnRemove old"}
+	if got := events.take(); !slices.Equal(got, want) {
+		t.Fatalf("first sync: got %v, want %v", got, want)
+	}
+
+	writeManifest("foo", "bar")
+	commit("foo", "upstream")
+	git("-C", filepath.Join(dir, "src", "foo"), "push", "-q", remote("foo")+".git", "main")
+	if err := os.WriteFile(filepath.Join(root, "bar", "README.md"), []byte("local"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Sync(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := events.take(), []string{"OnPull foo", "OnSkip bar"}; !slices.Equal(got, want) {
+		t.Fatalf("second sync: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Fmt formats the gitjoin.txt files, see formatGitjoinFile. With check
+// set, the files are only listed, and an error is returned if any needs
+// formatting.
+func Fmt(cfg Config, check bool) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	if !check {
+		unlock, err := s.lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	t, err := s.walk()
+	if err != nil {
+		return err
+	}
+	manifests, err := s.manifests(t)
+	if err != nil {
+		return err
+	}
+	var n int
+	for _, manifest := range manifests {
+		changed, err := s.formatManifest(manifest, !check)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		n++
+		if check {
+			s.log("%s\n", manifest)
+		} else {
+			s.log("Formatted %s\n", manifest)
+		}
+	}
+	if check && n > 0 {
+		return fmt.Errorf("%d files need formatting, run gitjoin fmt", n)
+	}
+	return nil
+}
+
+// formatManifest reports whether the gitjoin.txt file manifest needs
+// formatting, formatting it if write is set.
+func (s *Syncer) formatManifest(manifest string, write bool) (bool, error) {
+	filename := filepath.Join(s.Cfg.Root, manifest)
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+	formatted := formatGitjoinFile(b)
+	if bytes.Equal(formatted, b) {
+		return false, nil
+	}
+	if write {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return false, err
+		}
+		if err := writeFileAtomic(filename, formatted, info.Mode().Perm()); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Freeze records the current commit of the managed repo name in its
+// gitjoin.txt entry as freeze=<sha>. Syncs leave a frozen repo alone, and
+// clone it at that commit.
+func Freeze(cfg Config, name string) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	localPath, e, err := s.findManagedRepo(name)
+	if err != nil {
+		return err
+	}
+	repo := s.repo(localPath)
+	if !repo.IsGitRepo() {
+		return fmt.Errorf("%s: not cloned", localPath)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("%s: %w", localPath, err)
+	}
+	if _, err := setAnnotation(filepath.Join(s.Cfg.Root, e.File), e.Line, "freeze", head); err != nil {
+		return err
+	}
+	s.log("Froze %s at %s\n", localPath, head[:7])
+	return nil
+}
+
+// Unfreeze removes the freeze annotation of the managed repo name and
+// switches it back to its default branch if it's detached.
+func Unfreeze(cfg Config, name string) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	localPath, e, err := s.findManagedRepo(name)
+	if err != nil {
+		return err
+	}
+	changed, err := setAnnotation(filepath.Join(s.Cfg.Root, e.File), e.Line, "freeze", "")
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return fmt.Errorf("%s: not frozen on %s", localPath, e.location())
+	}
+	s.log("Unfroze %s\n", localPath)
+
+	repo := s.repo(localPath)
+	if !repo.IsGitRepo() {
+		return nil
+	}
+	st, err := repo.Status()
+	if err != nil || st.Branch != "" || st.dirty() {
+		return err
+	}
+	defaultBranch, err := repo.DefaultBranch()
+	if err != nil {
+		return fmt.Errorf("%s: %w", localPath, err)
+	}
+	if err := repo.SwitchBranch(defaultBranch); err != nil {
+		return fmt.Errorf("%s: %w", localPath, err)
+	}
+	s.log("Switched %s to %s\n", localPath, defaultBranch)
+	return nil
+}
+
+// findManagedRepo returns the local path and entry of the managed repo
+// name, see findRepo.
+func (s *Syncer) findManagedRepo(name string) (string, entry, error) {
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return "", entry{}, err
+	}
+	localPath, err := findRepo(expected, name)
+	if err != nil {
+		return "", entry{}, err
+	}
+	return localPath, expected[localPath], nil
+}
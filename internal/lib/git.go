@@ -5,16 +5,53 @@ package lib
 
 import (
 	"bytes"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 )
 
 type Repo struct {
 	Path string
+
+	gitBin    string     // defaults to git
+	gitArgs   []string   // passed before the command, e.g. -c key=value
+	env       []string   // added to the environment of git
+	fetchArgs []string   // passed to git fetch, e.g. --negotiation-tip
+	cache     *metaCache // optional
+	stats     *repoStats // optional
+
+	// interactive allows git to prompt for credentials.
+	interactive bool
+
+	// noSwitch is set for git before 2.23, which has no git switch.
+	noSwitch bool
+
+	// ctx kills the git commands when cancelled (optional).
+	ctx context.Context
+}
+
+// repoStats accumulates resource usage of the git commands run for a repo.
+type repoStats struct {
+	cpu      time.Duration
+	received int64 // bytes of the packs cloned
+
+	// unreachable is why the repo failed to reach its remote, if it did.
+	unreachable string
+}
+
+func (r Repo) record(cmd *exec.Cmd) {
+	if r.stats != nil && cmd.ProcessState != nil {
+		r.stats.cpu += cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	}
 }
 
 func (r Repo) IsGitRepo() bool {
@@ -22,16 +59,59 @@ func (r Repo) IsGitRepo() bool {
 	return err == nil && info.IsDir()
 }
 
-func (r Repo) DefaultBranch() (string, error) {
-	out, err := r.run("symbolic-ref", "refs/remotes/origin/HEAD")
-	if err != nil {
-		return "", err
+// leftover returns why the directory looks like the remains of an
+// interrupted clone, or "" if it doesn't.
+func (r Repo) leftover() string {
+	if entries, err := os.ReadDir(r.Path); err == nil && len(entries) == 0 {
+		return "empty directory"
 	}
-	parts := strings.Split(strings.TrimSpace(out), "/")
-	if len(parts) == 0 {
-		return "", fmt.Errorf("could not parse default branch")
+	if !r.IsGitRepo() {
+		return ""
+	}
+	var exitErr *exec.ExitError
+	if _, err := r.run("rev-parse", "--verify", "-q", "HEAD"); !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		return ""
+	}
+	if _, err := os.Stat(filepath.Join(r.Path, ".git", "index.lock")); err == nil {
+		return "no commits, index.lock present"
+	}
+	return "no commits"
+}
+
+func (r Repo) DefaultBranch() (string, error) {
+	return r.cache.get(r.Path, "default-branch", filepath.Join(r.Path, ".git", "refs", "remotes", "origin", "HEAD"), func() (string, error) {
+		out, err := r.run("symbolic-ref", "refs/remotes/origin/HEAD")
+		if err != nil {
+			return "", err
+		}
+		parts := strings.Split(strings.TrimSpace(out), "/")
+		if len(parts) == 0 {
+			return "", fmt.Errorf("could not parse default branch")
+		}
+		return parts[len(parts)-1], nil
+	})
+}
+
+// RefreshDefaultBranch returns the default branch after a fetch, asking
+// the remote for it only if origin/HEAD is missing or points to a branch
+// the fetch pruned, which is what renaming the default branch leaves.
+func (r Repo) RefreshDefaultBranch() (string, error) {
+	if _, err := r.run("rev-parse", "-q", "--verify", "refs/remotes/origin/HEAD"); err != nil {
+		if _, err := r.run("remote", "set-head", "origin", "--auto"); err != nil {
+			return "", err
+		}
 	}
-	return parts[len(parts)-1], nil
+	return r.DefaultBranch()
+}
+
+func (r Repo) RemoteURL() (string, error) {
+	return r.cache.get(r.Path, "remote-url", filepath.Join(r.Path, ".git", "config"), func() (string, error) {
+		out, err := r.run("config", "remote.origin.url")
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(out), nil
+	})
 }
 
 func (r Repo) CurrentBranch() (string, error) {
@@ -42,26 +122,111 @@ func (r Repo) CurrentBranch() (string, error) {
 	return strings.TrimSpace(out), nil
 }
 
+// Operation returns the git operation in progress in the repo, e.g. a
+// merge or a rebase stopped at a conflict, or "" if there's none.
+func (r Repo) Operation() string {
+	for _, op := range []struct{ file, name string }{
+		{"rebase-merge", "rebase"},
+		{"rebase-apply", "rebase"},
+		{"MERGE_HEAD", "merge"},
+		{"CHERRY_PICK_HEAD", "cherry-pick"},
+		{"REVERT_HEAD", "revert"},
+	} {
+		if _, err := os.Stat(filepath.Join(r.Path, ".git", op.file)); err == nil {
+			return op.name
+		}
+	}
+	return ""
+}
+
 func (r Repo) HasUncommittedChanges() (bool, error) {
-	out, err := r.run("status", "--porcelain")
+	st, err := r.Status()
+	return st.dirty(), err
+}
+
+// repoStatus is the state of a repo as reported by a single git status.
+type repoStatus struct {
+	Branch  string   // empty when detached
+	Head    string   // empty before the first commit
+	Changes []string // XY status code per changed path, ?? if untracked
+}
+
+func (st repoStatus) dirty() bool {
+	return len(st.Changes) > 0
+}
+
+// Status returns the current branch, HEAD and changes of the repo.
+func (r Repo) Status() (repoStatus, error) {
+	var st repoStatus
+	out, err := r.run("status", "--porcelain=v2", "--branch")
+	if err != nil {
+		return st, err
+	}
+	for line := range strings.SplitSeq(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "#":
+			if len(fields) < 3 {
+				continue
+			}
+			switch {
+			case fields[1] == "branch.oid" && fields[2] != "(initial)":
+				st.Head = fields[2]
+			case fields[1] == "branch.head" && fields[2] != "(detached)":
+				st.Branch = fields[2]
+			}
+		case "1", "2", "u":
+			st.Changes = append(st.Changes, fields[1])
+		case "?":
+			st.Changes = append(st.Changes, "??")
+		}
+	}
+	return st, nil
+}
+
+// Diff returns the uncommitted changes to tracked files, as a patch or,
+// with stat set, a diffstat.
+func (r Repo) Diff(stat, color bool) (string, error) {
+	args := []string{"diff", "HEAD", "--color=never"}
+	if color {
+		args[2] = "--color=always"
+	}
+	if stat {
+		args = append(args, "--stat")
+	}
+	return r.run(args...)
+}
+
+// HasTrackedChanges reports whether any tracked files are modified.
+func (r Repo) HasTrackedChanges() (bool, error) {
+	out, err := r.run("status", "--porcelain", "--untracked-files=no")
 	if err != nil {
 		return false, err
 	}
 	return strings.TrimSpace(out) != "", nil
 }
 
-func (r Repo) ChangesSummary() string {
-	out, _ := r.run("status", "--porcelain")
-	lines := strings.Split(strings.TrimSpace(out), "\n")
-	if len(lines) == 1 && lines[0] == "" {
+// Commit commits all changes to tracked files and, with all set,
+// untracked files.
+func (r Repo) Commit(message string, all bool) error {
+	if all {
+		if _, err := r.run("add", "--all"); err != nil {
+			return err
+		}
+	}
+	_, err := r.run("commit", "--all", "--message", message)
+	return err
+}
+
+func (st repoStatus) summary() string {
+	if !st.dirty() {
 		return "no changes"
 	}
 	var modified, added, deleted int
-	for _, line := range lines {
-		if len(line) < 2 {
-			continue
-		}
-		status := line[:2]
+	for _, status := range st.Changes {
 		if strings.Contains(status, "M") {
 			modified++
 		} else if strings.Contains(status, "A") || strings.Contains(status, "?") {
@@ -81,28 +246,172 @@ func (r Repo) ChangesSummary() string {
 		parts = append(parts, fmt.Sprintf("%d deleted", deleted))
 	}
 	if len(parts) == 0 {
-		return fmt.Sprintf("%d changes", len(lines))
+		return fmt.Sprintf("%d changes", len(st.Changes))
 	}
 	return strings.Join(parts, ", ")
 }
 
-func (r Repo) Pull() (changed bool, err error) {
-	headBefore, err := r.run("rev-parse", "HEAD")
+// Pull fast-forwards the current branch to its upstream as of the last
+// fetch. If the branch has diverged from it, a *divergedError is returned.
+// It returns the number of commits pulled.
+func (r Repo) Pull() (int, error) {
+	ahead, behind, err := r.AheadBehind("HEAD", "@{upstream}")
 	if err != nil {
-		return false, err
+		return 0, err
 	}
-	if _, err := r.run("pull"); err != nil {
-		return false, err
+	if behind == 0 {
+		return 0, nil
+	}
+	if ahead > 0 {
+		return 0, &divergedError{ahead: ahead, behind: behind}
+	}
+	if _, err := r.run("merge", "--ff-only", "@{upstream}"); err != nil {
+		return 0, err
+	}
+	return behind, nil
+}
+
+// fetch fetches from origin, pruning branches deleted there. If the remote
+// redirected the fetch, redirect is the URL it redirected to.
+func (r Repo) fetch() (redirect string, err error) {
+	cmd := r.command(append([]string{"fetch", "--prune"}, r.fetchArgs...)...)
+	cmd.Dir = r.Path
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	r.record(cmd)
+	if err != nil {
+		return "", fmt.Errorf("git fetch: %w: %s", err, stderr.String())
+	}
+	return redirectURL(stderr.String()), nil
+}
+
+// redirectURL returns the URL git reports being redirected to in the
+// error output msg, e.g. when a repo has been renamed on GitHub, or "".
+func redirectURL(msg string) string {
+	for line := range strings.Lines(msg) {
+		if u, ok := strings.CutPrefix(strings.TrimSpace(line), "warning: redirecting to "); ok {
+			return u
+		}
+	}
+	return ""
+}
+
+type divergedError struct {
+	ahead, behind int
+}
+
+func (e *divergedError) Error() string {
+	return fmt.Sprintf("diverged from origin by %d/%d commits", e.ahead, e.behind)
+}
+
+func (r Repo) Head() (string, error) {
+	out, err := r.run("rev-parse", "HEAD")
+	return strings.TrimSpace(out), err
+}
+
+// VerifyCommit verifies the signature of rev. allowedSigners is an optional
+// allowed signers file used for SSH signatures.
+func (r Repo) VerifyCommit(rev, allowedSigners string) error {
+	var args []string
+	if allowedSigners != "" {
+		args = append(args, "-c", "gpg.ssh.allowedSignersFile="+allowedSigners)
+	}
+	_, err := r.run(append(args, "verify-commit", rev)...)
+	return err
+}
+
+func (r Repo) ResetHard(rev string) error {
+	_, err := r.run("reset", "--hard", rev)
+	return err
+}
+
+// FetchTags fetches all tags from origin and returns the new ones.
+func (r Repo) FetchTags() ([]string, error) {
+	before, err := r.run("tag", "--list")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.run("fetch", "--tags", "origin"); err != nil {
+		return nil, err
+	}
+	after, err := r.run("tag", "--list")
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool)
+	for tag := range strings.FieldsSeq(before) {
+		existing[tag] = true
+	}
+	var newTags []string
+	for tag := range strings.FieldsSeq(after) {
+		if !existing[tag] {
+			newTags = append(newTags, tag)
+		}
+	}
+	return newTags, nil
+}
+
+// releaseTag matches the tags of releases, e.g. v1.2.3, but not of
+// pre-releases.
+var releaseTag = regexp.MustCompile(`^v?\d+\.\d+\.\d+$`)
+
+// LatestTag returns the newest release tag by version, or "" if there's
+// none.
+func (r Repo) LatestTag() (string, error) {
+	out, err := r.run("tag", "--list", "--sort=-v:refname")
+	if err != nil {
+		return "", err
+	}
+	for tag := range strings.FieldsSeq(out) {
+		if releaseTag.MatchString(tag) {
+			return tag, nil
+		}
 	}
-	headAfter, err := r.run("rev-parse", "HEAD")
+	return "", nil
+}
+
+// CheckoutTag detaches HEAD at tag and reports whether HEAD moved.
+func (r Repo) CheckoutTag(tag string) (bool, error) {
+	head, _ := r.Head()
+	commit, err := r.run("rev-parse", tag+"^{commit}")
 	if err != nil {
 		return false, err
 	}
-	return headBefore != headAfter, nil
+	if strings.TrimSpace(commit) == head {
+		if branch, _ := r.CurrentBranch(); branch == "" {
+			return false, nil
+		}
+	}
+	_, err = r.run("checkout", "--quiet", "--detach", tag)
+	return err == nil, err
+}
+
+// SparseCheckout returns the sorted sparse checkout paths, or nil if
+// sparse checkout is not enabled.
+func (r Repo) SparseCheckout() ([]string, error) {
+	enabled, _ := r.run("config", "--bool", "core.sparseCheckout")
+	if strings.TrimSpace(enabled) != "true" {
+		return nil, nil
+	}
+	out, err := r.run("sparse-checkout", "list")
+	if err != nil {
+		return nil, err
+	}
+	paths := strings.Fields(out)
+	slices.Sort(paths)
+	return paths, nil
+}
+
+func (r Repo) SetSparseCheckout(paths []string) error {
+	_, err := r.run(append([]string{"sparse-checkout", "set"}, paths...)...)
+	return err
 }
 
+const stashMessage = "gitjoin"
+
 func (r Repo) Stash() error {
-	_, err := r.run("stash", "push", "-m", "gitjoin")
+	_, err := r.run("stash", "push", "-m", stashMessage)
 	return err
 }
 
@@ -111,26 +420,246 @@ func (r Repo) Unstash() error {
 	return err
 }
 
+type stashEntry struct {
+	Ref     string // e.g. stash@{0}
+	Subject string
+	Date    string // relative
+}
+
+// Stashes returns the stashes created by gitjoin, newest first.
+func (r Repo) Stashes() ([]stashEntry, error) {
+	out, err := r.run("stash", "list", "--format=%gd%x09%gs%x09%cr")
+	if err != nil {
+		return nil, err
+	}
+	var stashes []stashEntry
+	for line := range strings.SplitSeq(strings.TrimSpace(out), "\n") {
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) != 3 || !strings.HasSuffix(parts[1], ": "+stashMessage) {
+			continue
+		}
+		stashes = append(stashes, stashEntry{Ref: parts[0], Subject: parts[1], Date: parts[2]})
+	}
+	return stashes, nil
+}
+
+func (r Repo) PopStash(ref string) error {
+	_, err := r.run("stash", "pop", ref)
+	return err
+}
+
 func (r Repo) SwitchBranch(branch string) error {
+	if r.noSwitch {
+		_, err := r.run("checkout", branch)
+		return err
+	}
 	_, err := r.run("switch", branch)
 	return err
 }
 
+// AheadBehind returns the number of commits the local branch is ahead of
+// and behind upstream, e.g. origin/main.
+func (r Repo) AheadBehind(branch, upstream string) (ahead, behind int, err error) {
+	out, err := r.run("rev-list", "--left-right", "--count", branch+"..."+upstream)
+	if err != nil {
+		return 0, 0, err
+	}
+	_, err = fmt.Sscan(out, &ahead, &behind)
+	return ahead, behind, err
+}
+
+// PruneBranches deletes local branches whose upstream is gone and that are
+// fully merged into target. The current branch is never deleted.
+func (r Repo) PruneBranches(target, current string) ([]string, error) {
+	out, err := r.run("for-each-ref", "--format=%(refname:short)\t%(upstream:track)", "refs/heads")
+	if err != nil {
+		return nil, err
+	}
+	merged, err := r.run("branch", "--format=%(refname:short)", "--merged", target)
+	if err != nil {
+		return nil, err
+	}
+	isMerged := make(map[string]bool)
+	for b := range strings.FieldsSeq(merged) {
+		isMerged[b] = true
+	}
+
+	var pruned []string
+	for line := range strings.SplitSeq(strings.TrimSpace(out), "\n") {
+		branch, track, _ := strings.Cut(line, "\t")
+		if track != "[gone]" || branch == current || !isMerged[branch] {
+			continue
+		}
+		if _, err := r.run("branch", "-d", branch); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, branch)
+	}
+	return pruned, nil
+}
+
+// IsOnBranch reports whether rev is reachable from any local or remote branch.
+func (r Repo) IsOnBranch(rev string) bool {
+	out, err := r.run("for-each-ref", "--count=1", "--contains", rev, "refs/heads", "refs/remotes")
+	return err == nil && strings.TrimSpace(out) != ""
+}
+
+func (r Repo) HasBranch(branch string) bool {
+	_, err := r.run("show-ref", "--verify", "--quiet", "refs/heads/"+branch)
+	return err == nil
+}
+
+func (r Repo) HasRemoteBranch(branch string) bool {
+	_, err := r.run("show-ref", "--verify", "--quiet", "refs/remotes/origin/"+branch)
+	return err == nil
+}
+
+func (r Repo) CreateBranch(branch string) error {
+	if r.noSwitch {
+		_, err := r.run("checkout", "-b", branch)
+		return err
+	}
+	_, err := r.run("switch", "-c", branch)
+	return err
+}
+
+// RenameBranch renames a local branch and sets its upstream to the
+// remote branch with the new name.
+func (r Repo) RenameBranch(from, to string) error {
+	if _, err := r.run("branch", "-m", from, to); err != nil {
+		return err
+	}
+	_, err := r.run("branch", "--set-upstream-to=origin/"+to, to)
+	return err
+}
+
+func (r Repo) command(args ...string) *exec.Cmd {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cmd := exec.CommandContext(ctx, cmp.Or(r.gitBin, "git"), append(slices.Clone(r.gitArgs), args...)...)
+	cmd.Env = append(os.Environ(), r.env...)
+	if !r.interactive {
+		// Fail instead of hanging on a credentials prompt, unless set by the user.
+		if _, ok := os.LookupEnv("GIT_TERMINAL_PROMPT"); !ok {
+			cmd.Env = append(cmd.Env, "GIT_TERMINAL_PROMPT=0")
+		}
+		if _, ok := os.LookupEnv("GIT_SSH_COMMAND"); !ok {
+			cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND=ssh -oBatchMode=yes")
+		}
+	}
+	return cmd
+}
+
+// errAuth is returned when git needs credentials it's not allowed to prompt for.
+var errAuth = errors.New("authentication required, use -interactive-auth to be prompted")
+
+// isAuthError reports whether the git error output msg looks like
+// credentials were needed.
+func isAuthError(msg string) bool {
+	for _, s := range []string{
+		"terminal prompts disabled",
+		"could not read Username",
+		"could not read Password",
+		"Authentication failed",
+		"Permission denied (publickey",
+	} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNetworkError reports whether the git error output msg looks like the
+// remote couldn't be reached.
+func isNetworkError(msg string) bool {
+	for _, s := range []string{
+		"Could not resolve host",
+		"Could not resolve hostname",
+		"Failed to connect to",
+		"Connection refused",
+		"Connection timed out",
+		"Network is unreachable",
+		"Operation timed out",
+	} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
 func (r Repo) run(args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
+	cmd := r.command(args...)
 	cmd.Dir = r.Path
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
+	err := cmd.Run()
+	r.record(cmd)
+	if err != nil {
 		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, stderr.String())
 	}
 	return stdout.String(), nil
 }
 
-func clone(url, path string, out io.Writer) error {
-	cmd := exec.Command("git", "clone", url, path)
+// SetConfig sets the local git config key to value and reports whether
+// it changed.
+func (r Repo) SetConfig(key, value string) (bool, error) {
+	current, _ := r.run("config", "--local", "--get", key)
+	if strings.TrimSuffix(current, "\n") == value {
+		return false, nil
+	}
+	if _, err := r.run("config", "--local", key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PartialCloneFilter returns the filter used when the repo was cloned
+// as a partial clone, or an empty string.
+func (r Repo) PartialCloneFilter() string {
+	out, _ := r.run("config", "remote.origin.partialclonefilter")
+	return strings.TrimSpace(out)
+}
+
+// SingleBranch reports whether only one branch is fetched from origin.
+func (r Repo) SingleBranch() bool {
+	out, _ := r.run("config", "--get-all", "remote.origin.fetch")
+	return out != "" && !strings.Contains(out, "*")
+}
+
+// clone clones url into r.Path. If the remote redirected the clone,
+// redirect is the URL it redirected to.
+func (r Repo) clone(url string, args []string, out io.Writer) (redirect string, err error) {
+	cmd := r.command(append(append([]string{"clone"}, args...), url, r.Path)...)
+	var stderr bytes.Buffer
 	cmd.Stdout = out
-	cmd.Stderr = out
-	return cmd.Run()
+	cmd.Stderr = io.MultiWriter(out, &stderr)
+	err = cmd.Run()
+	r.record(cmd)
+	if err != nil && isAuthError(stderr.String()) {
+		return "", errAuth
+	}
+	if err != nil && isNetworkError(stderr.String()) {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if err == nil && r.stats != nil {
+		r.stats.received += r.packSize()
+	}
+	return redirectURL(stderr.String()), err
+}
+
+// packSize returns the total size of the pack files in the repo.
+func (r Repo) packSize() int64 {
+	files, _ := filepath.Glob(filepath.Join(r.Path, ".git", "objects", "pack", "*.pack"))
+	var n int64
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			n += fi.Size()
+		}
+	}
+	return n
 }
@@ -0,0 +1,57 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// minGitVersion is the oldest git gitjoin works with, sparseGitVersion the
+// oldest that can do the sparse checkouts of the sparse annotation.
+var (
+	minGitVersion    = gitVersion{2, 22}
+	sparseGitVersion = gitVersion{2, 25}
+)
+
+// gitVersion is a git major and minor version.
+type gitVersion [2]int
+
+func (v gitVersion) less(other gitVersion) bool {
+	return cmp.Or(cmp.Compare(v[0], other[0]), cmp.Compare(v[1], other[1])) < 0
+}
+
+func (v gitVersion) String() string {
+	return fmt.Sprintf("%d.%d", v[0], v[1])
+}
+
+var gitVersionRe = regexp.MustCompile(`^git version (\d+)\.(\d+)`)
+
+// probeGit checks that the git binary of cfg can be run and is at least
+// minGitVersion, and returns its version.
+func probeGit(cfg Config) (gitVersion, error) {
+	bin := cmp.Or(cfg.GitBin, "git")
+	out, err := Repo{gitBin: cfg.GitBin, gitArgs: cfg.GitArgs, env: cfg.gitEnv}.run("version")
+	if errors.Is(err, exec.ErrNotFound) {
+		return gitVersion{}, fmt.Errorf("%s not found, install git or set -git-bin", bin)
+	}
+	if err != nil {
+		return gitVersion{}, err
+	}
+	m := gitVersionRe.FindStringSubmatch(out)
+	if m == nil {
+		return gitVersion{}, fmt.Errorf("%s: unexpected version %q", bin, out)
+	}
+	var v gitVersion
+	v[0], _ = strconv.Atoi(m[1])
+	v[1], _ = strconv.Atoi(m[2])
+	if v.less(minGitVersion) {
+		return v, fmt.Errorf("%s is version %s, gitjoin needs %s or later", bin, v, minGitVersion)
+	}
+	return v, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"go/version"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	goWorkStart = "// Managed by gitjoin - do not edit this section"
+	goWorkEnd   = "// End gitjoin managed section"
+)
+
+var goDirective = regexp.MustCompile(`(?m)^go[ \t]+(\S+)[ \t]*$`)
+
+// updateGoWork writes the managed block with a use directive for each
+// managed repo with a go.mod to go.work in the root, and raises its go
+// version to the highest one of the modules.
+func (s *Syncer) updateGoWork(managed map[string]entry) error {
+	var (
+		use       []string
+		goVersion string
+	)
+	for _, localPath := range slices.Sorted(maps.Keys(managed)) {
+		b, err := os.ReadFile(filepath.Join(s.Cfg.Root, localPath, "go.mod"))
+		if err != nil {
+			continue
+		}
+		use = append(use, "./"+filepath.ToSlash(localPath))
+		if m := goDirective.FindSubmatch(b); m != nil && version.Compare("go"+string(m[1]), "go"+goVersion) > 0 {
+			goVersion = string(m[1])
+		}
+	}
+
+	filename := filepath.Join(s.Cfg.Root, "go.work")
+	existing, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(existing) == 0 && len(use) == 0 {
+		return nil
+	}
+
+	var block strings.Builder
+	block.WriteString(goWorkStart + "\nuse (\n")
+	for _, dir := range use {
+		block.WriteString("\t" + dir + "\n")
+	}
+	block.WriteString(")\n" + goWorkEnd + "\n")
+
+	content := string(existing)
+	newContent, found := replaceBlock(content, goWorkStart, goWorkEnd, block.String())
+	if !found {
+		if newContent != "" {
+			newContent = strings.TrimRight(newContent, "\n") + "\n\n"
+		}
+		newContent += block.String()
+	}
+	if goVersion != "" {
+		m := goDirective.FindStringSubmatchIndex(newContent)
+		switch {
+		case m == nil:
+			newContent = "go " + goVersion + "\n\n" + newContent
+		case version.Compare("go"+newContent[m[2]:m[3]], "go"+goVersion) < 0:
+			newContent = newContent[:m[2]] + goVersion + newContent[m[3]:]
+		}
+	}
+	if newContent == content {
+		return nil
+	}
+	return writeFileAtomic(filename, []byte(newContent), 0o644)
+}
@@ -0,0 +1,84 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// resultGroup is the part of a Result for one group, see Config.GroupBy.
+type resultGroup struct {
+	Name string
+	Result
+}
+
+func validateGroupBy(groupBy string) error {
+	switch groupBy {
+	case "", "dir", "manifest", "host", "owner":
+		return nil
+	}
+	return fmt.Errorf("invalid -group-by %q, must be dir, manifest, host or owner", groupBy)
+}
+
+// groupName returns the name of the group of the repo at localPath.
+func (r Result) groupName(groupBy, localPath string) string {
+	if groupBy == "dir" {
+		return path.Dir(localPath)
+	}
+	e, found := r.entries[localPath]
+	if !found {
+		return "(not managed)"
+	}
+	host, rest, _ := strings.Cut(e.Repo, "/")
+	owner, _, _ := strings.Cut(rest, "/")
+	switch groupBy {
+	case "manifest":
+		return e.File
+	case "host":
+		return host
+	default:
+		return host + "/" + owner
+	}
+}
+
+// groups splits r by groupBy, sorted by name.
+func (r Result) groups(groupBy string) []resultGroup {
+	byName := make(map[string]*Result)
+	group := func(localPath string) *Result {
+		name := r.groupName(groupBy, localPath)
+		if byName[name] == nil {
+			byName[name] = &Result{}
+		}
+		return byName[name]
+	}
+	for _, v := range r.Updated {
+		g := group(v.Path)
+		g.Updated = append(g.Updated, v)
+	}
+	for _, v := range r.Cloned {
+		g := group(v.Path)
+		g.Cloned = append(g.Cloned, v)
+	}
+	for _, v := range r.Removed {
+		g := group(v)
+		g.Removed = append(g.Removed, v)
+	}
+	for _, v := range r.Skipped {
+		g := group(v.Path)
+		g.Skipped = append(g.Skipped, v)
+	}
+	for _, v := range r.Failed {
+		g := group(v.Path)
+		g.Failed = append(g.Failed, v)
+	}
+	var groups []resultGroup
+	for _, name := range slices.Sorted(maps.Keys(byName)) {
+		groups = append(groups, resultGroup{Name: name, Result: *byName[name]})
+	}
+	return groups
+}
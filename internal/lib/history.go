@@ -0,0 +1,131 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	historyFile = ".gitjoin/history"
+	historyMax  = 100 // runs kept
+)
+
+// record is a sync recorded in the history, one JSON object per line.
+type record struct {
+	Time time.Time
+	Args []string
+	Result
+	RemovedRepos []removedRepo `json:",omitempty"`
+}
+
+// removedRepo is a repo removed by a sync, with what's needed to restore it.
+type removedRepo struct {
+	Path string
+	URL  string // origin
+	Head string
+}
+
+func loadHistory(root string) ([]record, error) {
+	f, err := os.Open(filepath.Join(root, historyFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var runs []record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, scanner.Err()
+}
+
+// appendHistory adds the result of a sync to the history, keeping the
+// last historyMax runs.
+func appendHistory(root string, args []string, result Result) error {
+	runs, err := loadHistory(root)
+	if err != nil {
+		return err
+	}
+	result.Duration, result.Timings = 0, nil
+	runs = append(runs, record{Time: time.Now().Round(time.Second), Args: redactArgs(args), Result: result, RemovedRepos: result.removed})
+	runs = runs[max(len(runs)-historyMax, 0):]
+
+	var b bytes.Buffer
+	for _, r := range runs {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		b.Write(append(line, '\n'))
+	}
+	filename := filepath.Join(root, historyFile)
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, b.Bytes(), 0o644)
+}
+
+// secretFlags are the flags whose values are left out of the history.
+var secretFlags = []string{"token", "notify-webhook"}
+
+// redactArgs returns args with the values of secretFlags replaced by
+// "redacted".
+func redactArgs(args []string) []string {
+	redacted := slices.Clone(args)
+	for i := 0; i < len(redacted); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(redacted[i], "-"), "=")
+		if !strings.HasPrefix(redacted[i], "-") || !slices.Contains(secretFlags, name) {
+			continue
+		}
+		switch {
+		case hasValue && value != "":
+			redacted[i] = strings.TrimSuffix(redacted[i], value) + "redacted"
+		case !hasValue && i+1 < len(redacted):
+			i++
+			redacted[i] = "redacted"
+		}
+	}
+	return redacted
+}
+
+// Log prints the last n runs in the history, newest first.
+func Log(cfg Config, n int) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	runs, err := loadHistory(cfg.Root)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		s.log("No runs recorded\n")
+		return nil
+	}
+	runs = runs[max(len(runs)-n, 0):]
+	for _, r := range slices.Backward(runs) {
+		s.log("%s  %s\n", r.Time.Local().Format(time.DateTime), strings.Join(append([]string{"gitjoin"}, r.Args...), " "))
+		if len(r.Updated)+len(r.Cloned)+len(r.Removed)+len(r.Skipped)+len(r.Failed) == 0 {
+			s.log("  Nothing to do\n")
+		}
+		s.printIndented("  ", resultSections(r.Result)...)
+	}
+	return nil
+}
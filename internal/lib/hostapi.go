@@ -0,0 +1,104 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// hostAPI looks up repos on GitHub or GitLab.
+type hostAPI struct {
+	github *githubClient // nil without a token
+
+	gitlabAPI   string
+	gitlabHost  string
+	gitlabToken string // empty without a token
+	client      *http.Client
+}
+
+func newHostAPI() *hostAPI {
+	c := &hostAPI{
+		gitlabAPI:   strings.TrimSuffix(cmp.Or(os.Getenv("GITLAB_API_URL"), "https://gitlab.com/api/v4"), "/"),
+		gitlabToken: os.Getenv("GITLAB_TOKEN"),
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+	if u, err := url.Parse(c.gitlabAPI); err == nil {
+		c.gitlabHost = u.Host
+	}
+	if token := cmp.Or(os.Getenv("GITHUB_TOKEN"), os.Getenv("GH_TOKEN")); token != "" {
+		c.github = newGithubClient(token)
+	}
+	return c
+}
+
+// hostRepo is a repo as seen by the API of its host.
+type hostRepo struct {
+	Host     string // GitHub or GitLab, empty if not looked up
+	Archived bool
+	PushedAt time.Time
+}
+
+// lookup looks up repoPath, e.g. github.com/bep/hugo. Repos on other
+// hosts, or on hosts without a token, aren't looked up.
+func (c *hostAPI) lookup(repoPath string) (hostRepo, error) {
+	host, ownerRepo, _ := strings.Cut(repoPath, "/")
+	var (
+		req *http.Request
+		err error
+	)
+	switch {
+	case host == "github.com" && c.github != nil:
+		host = "GitHub"
+		req, err = http.NewRequest("GET", c.github.api+"/repos/"+ownerRepo, nil)
+		if err == nil {
+			req.Header.Set("Accept", "application/vnd.github+json")
+			req.Header.Set("Authorization", "Bearer "+c.github.token)
+		}
+	case host == c.gitlabHost && c.gitlabToken != "":
+		host = "GitLab"
+		req, err = http.NewRequest("GET", c.gitlabAPI+"/projects/"+url.PathEscape(ownerRepo), nil)
+		if err == nil {
+			req.Header.Set("PRIVATE-TOKEN", c.gitlabToken)
+		}
+	default:
+		return hostRepo{}, nil
+	}
+	if err != nil {
+		return hostRepo{}, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return hostRepo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return hostRepo{}, fmt.Errorf("%s API: %s", host, resp.Status)
+	}
+	var result struct {
+		Archived       bool      `json:"archived"`
+		PushedAt       time.Time `json:"pushed_at"`        // GitHub
+		LastActivityAt time.Time `json:"last_activity_at"` // GitLab
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return hostRepo{}, fmt.Errorf("%s API: %w", host, err)
+	}
+	return hostRepo{Host: host, Archived: result.Archived, PushedAt: cmp.Or(result.PushedAt, result.LastActivityAt)}, nil
+}
+
+// pushedBefore reports whether the repo of e is known not to have been
+// pushed to since t. The API has a resolution of a second.
+func (c *hostAPI) pushedBefore(e entry, t time.Time) bool {
+	if t.IsZero() {
+		return false
+	}
+	r, err := c.lookup(e.Repo)
+	return err == nil && r.Host != "" && r.PushedAt.Before(t.Truncate(time.Second))
+}
@@ -0,0 +1,108 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Import adds the existing clones not already managed to the gitjoin.txt
+// file in their parent directory, creating it if needed.
+func Import(cfg Config) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	t, err := s.walk()
+	if err != nil {
+		return err
+	}
+	expected, err := s.allRepos(t)
+	if err != nil {
+		return err
+	}
+
+	var imported, skipped []RepoResult
+	byDir := make(map[string][]string)
+	for _, localPath := range t.repos {
+		if _, found := expected[localPath]; found {
+			continue
+		}
+		matched, err := s.matchPaths(localPath, "")
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		remote, err := s.repo(localPath).RemoteURL()
+		if err != nil {
+			skipped = append(skipped, RepoResult{Path: localPath, Detail: "no origin remote"})
+			continue
+		}
+		repoPath, ok := urlToRepoPath(remote)
+		if !ok {
+			skipped = append(skipped, RepoResult{Path: localPath, Detail: "unsupported URL " + remote})
+			continue
+		}
+		if !s.matchHostOwner(repoPath) {
+			continue
+		}
+		if filepath.Base(repoPath) != filepath.Base(localPath) {
+			skipped = append(skipped, RepoResult{Path: localPath, Detail: "directory name differs from " + repoPath})
+			continue
+		}
+		dir := filepath.Dir(localPath)
+		byDir[dir] = append(byDir[dir], manifestLine(repoPath, remote))
+		imported = append(imported, RepoResult{Path: localPath, Detail: repoPath})
+	}
+
+	for dir, repoPaths := range byDir {
+		if err := appendEntries(filepath.Join(s.Cfg.Root, dir, "gitjoin.txt"), repoPaths); err != nil {
+			return err
+		}
+	}
+
+	s.printSections(
+		section{colorGreen, "Imported", imported},
+		section{colorYellow, "Skipped", skipped},
+	)
+	return nil
+}
+
+// appendEntries adds repoPaths to the gitjoin.txt file filename, creating
+// it if needed.
+func appendEntries(filename string, repoPaths []string) error {
+	content, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		content = append(content, '\n')
+	}
+	content = append(content, strings.Join(repoPaths, "\n")+"\n"...)
+	return writeFileAtomic(filename, content, 0o644)
+}
+
+// manifestLine returns the gitjoin.txt line for repoPath cloned from url,
+// keeping SSH if that's what the clone uses.
+func manifestLine(repoPath, url string) string {
+	if isSSHURL(url) {
+		return repoPath + " protocol=ssh"
+	}
+	return repoPath
+}
+
+// isSSHURL reports whether url, e.g. git@github.com:bep/hugo.git, is
+// cloned over SSH.
+func isSSHURL(url string) bool {
+	return !strings.Contains(url, "://") || strings.HasPrefix(url, "ssh://")
+}
@@ -0,0 +1,92 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Init copies the gitjoin.txt files and gitjoin.toml from template, a
+// directory or a git repo URL, into the root and runs the first sync.
+// Existing files are never overwritten.
+func Init(cfg Config, template string) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	dir := template
+	if info, err := os.Stat(template); err != nil || !info.IsDir() {
+		tmp, err := os.MkdirTemp("", "gitjoin-template")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		dir = filepath.Join(tmp, "template")
+		out := io.Writer(os.Stderr)
+		if cfg.Quiet {
+			out = io.Discard
+		}
+		c, err := cfg.withCredentials()
+		if err != nil {
+			return err
+		}
+		repo := Repo{Path: dir, gitBin: c.GitBin, gitArgs: c.GitArgs, env: c.gitEnv, interactive: c.InteractiveAuth}
+		if _, err := repo.clone(template, []string{"--depth", "1"}, out); err != nil {
+			return fmt.Errorf("clone template: %w", err)
+		}
+	}
+
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if d.Name() == "gitjoin.txt" || rel == workspaceConfigFilename {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no gitjoin.txt files found in template %s", template)
+	}
+	for _, rel := range files {
+		if _, err := os.Stat(filepath.Join(cfg.Root, rel)); err == nil {
+			return fmt.Errorf("%s already exists", rel)
+		}
+	}
+	for _, rel := range files {
+		b, err := os.ReadFile(filepath.Join(dir, rel))
+		if err != nil {
+			return err
+		}
+		filename := filepath.Join(cfg.Root, rel)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filename, b, 0o644); err != nil {
+			return err
+		}
+	}
+
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	s.log("Created %d files from template\n", len(files))
+	_, err = s.sync()
+	return err
+}
@@ -0,0 +1,76 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// interruptGrace is how long git commands still running when the sync is
+// interrupted get to finish before they're killed.
+const interruptGrace = 10 * time.Second
+
+// trashDir is where directories are moved before they're removed.
+const trashDir = ".gitjoin/trash"
+
+var errInterrupted = errors.New("interrupted")
+
+// trapSignals makes SIGINT and SIGTERM stop the sync gracefully: no more
+// repos are started, and git commands still running are killed after
+// interruptGrace, or on a second signal. The returned func restores the
+// default behavior.
+func (s *Syncer) trapSignals() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	killCtx, kill := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigs:
+		case <-done:
+			return
+		}
+		s.log("\nInterrupted, waiting for running git commands to finish (again to abort)\n")
+		cancel()
+		select {
+		case <-sigs:
+		case <-time.After(interruptGrace):
+		case <-done:
+			return
+		}
+		kill()
+	}()
+	s.ctx, s.killCtx = ctx, killCtx
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+		s.ctx, s.killCtx = context.Background(), context.Background()
+		cancel()
+		kill()
+	}
+}
+
+// removeDir removes the directory localPath by moving it to the trash
+// first, so an interruption never leaves it half deleted.
+func (s *Syncer) removeDir(localPath string) error {
+	trash := filepath.Join(s.Cfg.Root, trashDir, url.PathEscape(localPath))
+	if err := os.RemoveAll(trash); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(trash), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(filepath.Join(s.Cfg.Root, localPath), trash); err != nil {
+		return err
+	}
+	return os.RemoveAll(trash)
+}
@@ -0,0 +1,86 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/pelletier/go-toml/v2"
+)
+
+var goModule = regexp.MustCompile(`(?m)^module[ \t]+"?([^"\s]+)"?`)
+
+// repoKind is the language of a repo and the name of the module or
+// package in it, detected from the go.mod, package.json, Cargo.toml or
+// pyproject.toml in its root.
+type repoKind struct {
+	Lang   string // go, node, rust or python
+	Module string
+}
+
+func (k repoKind) String() string {
+	noun := map[string]string{"go": "go module", "node": "npm package", "rust": "rust crate", "python": "python package"}[k.Lang]
+	if k.Module == "" {
+		return noun
+	}
+	return noun + " " + k.Module
+}
+
+// detectKind returns the kind of the repo in dir, the zero kind if it
+// has none of the files looked for.
+func detectKind(dir string) repoKind {
+	if b, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+		k := repoKind{Lang: "go"}
+		if m := goModule.FindSubmatch(b); m != nil {
+			k.Module = string(m[1])
+		}
+		return k
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "package.json")); err == nil {
+		var pkg struct{ Name string }
+		json.Unmarshal(b, &pkg)
+		return repoKind{Lang: "node", Module: pkg.Name}
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "Cargo.toml")); err == nil {
+		var cargo struct{ Package struct{ Name string } }
+		toml.Unmarshal(b, &cargo)
+		return repoKind{Lang: "rust", Module: cargo.Package.Name}
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "pyproject.toml")); err == nil {
+		var py struct{ Project struct{ Name string } }
+		toml.Unmarshal(b, &py)
+		return repoKind{Lang: "python", Module: py.Project.Name}
+	}
+	return repoKind{}
+}
+
+// matchKind reports whether the repo at localPath matches the -lang and
+// -module filters.
+func (s *Syncer) matchKind(localPath string) (bool, error) {
+	if len(s.Cfg.Langs) == 0 && len(s.Cfg.Modules) == 0 {
+		return true, nil
+	}
+	k := detectKind(filepath.Join(s.Cfg.Root, localPath))
+	if len(s.Cfg.Langs) > 0 && !slices.Contains(s.Cfg.Langs, k.Lang) {
+		return false, nil
+	}
+	if len(s.Cfg.Modules) == 0 {
+		return true, nil
+	}
+	if k.Module == "" {
+		return false, nil
+	}
+	for _, pattern := range s.Cfg.Modules {
+		matched, err := doublestar.Match(pattern, k.Module)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
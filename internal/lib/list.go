@@ -0,0 +1,36 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+)
+
+// List prints the managed repos to stdout with their repo path, the
+// gitjoin.txt line they're defined on and their kind, if detected.
+func List(cfg Config) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(s.stdout, 0, 4, 2, ' ', 0)
+	for _, localPath := range slices.Sorted(maps.Keys(expected)) {
+		e := expected[localPath]
+		line := fmt.Sprintf("%s\t%s\t%s", localPath, e.Repo, e.location())
+		if k := detectKind(filepath.Join(cfg.Root, localPath)); k.Lang != "" {
+			line += "\t" + k.String()
+		}
+		fmt.Fprintln(w, line)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,73 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockFile is held by the gitjoin syncing the root.
+const lockFile = ".gitjoin/lock"
+
+// lock takes the lock of the root, waiting for another gitjoin holding it
+// to finish if Config.Wait is set. A lock left behind by a gitjoin on this
+// host that's no longer running is taken over. The returned func releases
+// the lock.
+func (s *Syncer) lock() (func(), error) {
+	filename := filepath.Join(s.Cfg.Root, lockFile)
+	// Not MkdirAll, a missing root is an error.
+	if err := os.Mkdir(filepath.Dir(filename), 0o755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	waiting := false
+	for {
+		f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d %s\n", os.Getpid(), host)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(filename)
+				return nil, err
+			}
+			return func() { os.Remove(filename) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		var (
+			pid       int
+			otherHost string
+		)
+		b, err := os.ReadFile(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		fmt.Sscan(string(b), &pid, &otherHost)
+		if otherHost == host && !running(pid) {
+			if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			continue
+		}
+		holder := fmt.Sprintf("pid %d on %s", pid, otherHost)
+		if !s.Cfg.Wait {
+			return nil, fmt.Errorf("another gitjoin (%s) is syncing %s; use -wait to wait for it, or remove %s if it's not running", holder, s.Cfg.Root, filename)
+		}
+		if !waiting && !s.Cfg.ChangesOnly {
+			s.log("Waiting for another gitjoin (%s) to finish\n", holder)
+			waiting = true
+		}
+		time.Sleep(time.Second)
+	}
+}
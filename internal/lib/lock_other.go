@@ -0,0 +1,25 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !windows
+
+package lib
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// running reports whether the process with the given pid is running.
+func running(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
@@ -0,0 +1,420 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// entry is a repository line in a gitjoin.txt file, e.g.
+// "github.com/bep/hugo noclean".
+type entry struct {
+	Repo        string
+	Annotations map[string]string
+
+	// Where the entry is defined.
+	File string
+	Line int
+}
+
+// annotations are the known annotations.
+var annotations = []string{"off", "noclean", "filter", "tags", "verify-signatures", "sparse", "depth", "protocol", "config", "freeze", "latest-tag", "fsmonitor", "single-branch", "readonly"}
+
+// sparsePaths returns the sorted paths of the sparse annotation, e.g.
+// sparse=services/api,libs/core, or nil if not set.
+func (e entry) sparsePaths() []string {
+	v := e.Annotations["sparse"]
+	if v == "" {
+		return nil
+	}
+	paths := strings.Split(v, ",")
+	slices.Sort(paths)
+	return paths
+}
+
+// gitConfig returns the settings of the config annotation, e.g.
+// config=user.email=me@example.com,core.autocrlf=false.
+func (e entry) gitConfig() (map[string]string, error) {
+	v := e.Annotations["config"]
+	if v == "" {
+		return nil, nil
+	}
+	config := make(map[string]string)
+	for _, kv := range strings.Split(v, ",") {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s: invalid config %q, must be key=value", e.location(), kv)
+		}
+		config[key] = value
+	}
+	return config, nil
+}
+
+// validate checks the repo path and the annotations of e.
+func (e entry) validate() error {
+	if err := validateRepoPath(e.Repo, e.Annotations["protocol"]); err != nil {
+		return fmt.Errorf("%s: %w", e.location(), err)
+	}
+	_, err := e.gitConfig()
+	return err
+}
+
+// validateRepoPath checks that repoPath is a host/owner/repo path, e.g.
+// github.com/bep/hugo, or, with protocol=file, a path to a local repo.
+// Only a conservative set of characters is allowed, so a repo path can't
+// be used to inject options or shell syntax into the clone URL.
+func validateRepoPath(repoPath, protocol string) error {
+	for _, r := range repoPath {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case strings.ContainsRune("-._~/:", r):
+		default:
+			return fmt.Errorf("invalid character %q in %s", r, repoPath)
+		}
+	}
+	segments := strings.Split(repoPath, "/")
+	if protocol == "file" {
+		segments = strings.Split(strings.TrimPrefix(repoPath, "/"), "/")
+	}
+	for _, seg := range segments {
+		if seg == "" || seg == "." || seg == ".." || strings.HasPrefix(seg, "-") {
+			return fmt.Errorf("invalid path element %q in %s", seg, repoPath)
+		}
+	}
+	if protocol == "file" {
+		return nil
+	}
+	if len(segments) < 3 {
+		return fmt.Errorf("%s is not a host/owner/repo path", repoPath)
+	}
+	if !strings.Contains(segments[0], ".") {
+		return fmt.Errorf("host %q in %s is not a domain name", segments[0], repoPath)
+	}
+	if strings.Contains(strings.Join(segments[1:], "/"), ":") {
+		return fmt.Errorf("invalid character ':' in %s", repoPath)
+	}
+	return nil
+}
+
+// localPaths returns the local path of each of the entries of a
+// gitjoin.txt file in dir. Repos sharing a name are told apart by owner as
+// set by disambiguate: owner gives tool-a and tool-b, owner-dir a/tool and
+// b/tool. Otherwise they keep the same path.
+func localPaths(dir string, entries []entry, disambiguate string) []string {
+	count := make(map[string]int)
+	for _, e := range entries {
+		count[path.Base(e.Repo)]++
+	}
+	paths := make([]string, len(entries))
+	for i, e := range entries {
+		name := path.Base(e.Repo)
+		if count[name] > 1 {
+			owner := path.Base(path.Dir(e.Repo))
+			switch disambiguate {
+			case "owner":
+				name += "-" + owner
+			case "owner-dir":
+				name = owner + "/" + name
+			}
+		}
+		paths[i] = path.Join(dir, name)
+	}
+	return paths
+}
+
+func validateDisambiguate(disambiguate string) error {
+	switch disambiguate {
+	case "", "owner", "owner-dir":
+		return nil
+	}
+	return fmt.Errorf("invalid -disambiguate %q, must be owner or owner-dir", disambiguate)
+}
+
+func (e entry) location() string {
+	return fmt.Sprintf("%s:%d", e.File, e.Line)
+}
+
+func (e entry) has(annotation string) bool {
+	_, found := e.Annotations[annotation]
+	return found
+}
+
+// protocol returns the clone URL protocol of e, https for read-only repos
+// unless set.
+func (e entry) protocol() string {
+	if p := e.Annotations["protocol"]; p != "" || !e.has("readonly") {
+		return p
+	}
+	return "https"
+}
+
+// parseGitjoinFile parses the gitjoin.txt file at path relative to root.
+// Invalid entries are left out and reported together in the error, one
+// per line, along with the valid entries. keep are the patterns of the
+// !keep directives, relative to the file's directory.
+func parseGitjoinFile(root, path string) (entries []entry, keep []string, err error) {
+	f, err := os.Open(filepath.Join(root, path))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var (
+		errs     []error
+		defaults map[string]string // set by !set directives
+		host     string            // set by !host directive
+		aliases  map[string]string // set by !alias directives
+		lineNum  int
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if directive, ok := strings.CutPrefix(line, "!"); ok {
+			fields := strings.Fields(directive)
+			if len(fields) == 0 {
+				return nil, nil, fmt.Errorf("%s:%d: empty directive", path, lineNum)
+			}
+			switch fields[0] {
+			case "set":
+				defaults = parseAnnotations(defaults, fields[1:])
+			case "host":
+				if len(fields) > 2 {
+					return nil, nil, fmt.Errorf("%s:%d: !host takes one argument", path, lineNum)
+				}
+				host = ""
+				if len(fields) == 2 {
+					host = resolveAlias(aliases, strings.Trim(fields[1], "/"))
+				}
+			case "alias":
+				name, target, ok := "", "", len(fields) == 2
+				if ok {
+					name, target, ok = strings.Cut(fields[1], "=")
+				}
+				if !ok || name == "" || target == "" || strings.ContainsAny(name, "./") {
+					return nil, nil, fmt.Errorf("%s:%d: !alias takes one name=host argument, e.g. gh=github.com", path, lineNum)
+				}
+				if v := os.Getenv(aliasEnv(name)); v != "" {
+					target = v
+				}
+				if aliases == nil {
+					aliases = make(map[string]string)
+				}
+				aliases[name] = strings.Trim(target, "/")
+			case "keep":
+				if len(fields) != 2 || !doublestar.ValidatePattern(fields[1]) {
+					return nil, nil, fmt.Errorf("%s:%d: !keep takes one pattern, e.g. scratch/*", path, lineNum)
+				}
+				keep = append(keep, fields[1])
+			default:
+				return nil, nil, fmt.Errorf("%s:%d: unknown directive %q", path, lineNum, fields[0])
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		repo := resolveAlias(aliases, fields[0])
+		if host != "" && !strings.Contains(repo, "/") {
+			repo = host + "/" + repo
+		}
+		e := entry{
+			Repo:        repo,
+			Annotations: parseAnnotations(maps.Clone(defaults), fields[1:]),
+			File:        path,
+			Line:        lineNum,
+		}
+		if err := e.validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return entries, keep, errors.Join(errs...)
+}
+
+// resolveAlias replaces the first element of repoPath with the host it's
+// an alias for, if any.
+func resolveAlias(aliases map[string]string, repoPath string) string {
+	first, rest, found := strings.Cut(repoPath, "/")
+	target, ok := aliases[first]
+	switch {
+	case !ok:
+		return repoPath
+	case !found:
+		return target
+	}
+	return target + "/" + rest
+}
+
+// aliasEnv returns the environment variable that overrides the host of
+// the alias name, e.g. GITJOIN_ALIAS_GH for gh.
+func aliasEnv(name string) string {
+	return "GITJOIN_ALIAS_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// setAnnotation sets the annotation key to value on line lineNum of the
+// gitjoin.txt file filename, or removes it if value is empty. It reports
+// whether the file was changed.
+func setAnnotation(filename string, lineNum int, key, value string) (bool, error) {
+	return editLine(filename, lineNum, func(fields []string) []string {
+		var updated []string
+		for _, field := range fields {
+			if k, _, _ := strings.Cut(field, "="); k != key {
+				updated = append(updated, field)
+			}
+		}
+		if value != "" {
+			updated = append(updated, key+"="+value)
+		}
+		return updated
+	})
+}
+
+// setRepo replaces the repo path of entry e with repoPath in the
+// gitjoin.txt file filename. A repo written relative to a !host directive
+// stays relative if repoPath is below the same host.
+func setRepo(filename string, e entry, repoPath string) (bool, error) {
+	return editLine(filename, e.Line, func(fields []string) []string {
+		updated := slices.Clone(fields)
+		updated[0] = repoPath
+		if !strings.Contains(fields[0], "/") {
+			prefix := strings.TrimSuffix(e.Repo, fields[0])
+			if name, ok := strings.CutPrefix(repoPath, prefix); ok && !strings.Contains(name, "/") {
+				updated[0] = name
+			}
+		}
+		return updated
+	})
+}
+
+// editLine replaces the fields of line lineNum of the file filename with
+// the result of fn and reports whether the file was changed.
+func editLine(filename string, lineNum int, fn func(fields []string) []string) (bool, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+	lines := strings.Split(string(b), "\n")
+	if lineNum < 1 || lineNum > len(lines) {
+		return false, fmt.Errorf("%s:%d: no such line", filename, lineNum)
+	}
+	line, cr := strings.CutSuffix(lines[lineNum-1], "\r")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, fmt.Errorf("%s:%d: empty line", filename, lineNum)
+	}
+	updated := fn(fields)
+	if slices.Equal(fields, updated) {
+		return false, nil
+	}
+	line = strings.Join(updated, " ")
+	if cr {
+		line += "\r"
+	}
+	lines[lineNum-1] = line
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return false, err
+	}
+	return true, writeFileAtomic(filename, []byte(strings.Join(lines, "\n")), fi.Mode().Perm())
+}
+
+// parseAnnotations parses key=value (or key) fields into m.
+func parseAnnotations(m map[string]string, fields []string) map[string]string {
+	for _, field := range fields {
+		if m == nil {
+			m = make(map[string]string)
+		}
+		k, v, _ := strings.Cut(field, "=")
+		m[k] = v
+	}
+	return m
+}
+
+// formatGitjoinFile returns the content of a gitjoin.txt file normalized:
+// entries sorted and deduplicated within each block of consecutive entry
+// lines, hosts lowercased, single spaces between fields and no repeated
+// blank lines. Comments and directives are kept in place, and so are CRLF
+// line endings.
+func formatGitjoinFile(b []byte) []byte {
+	eol := "\n"
+	if bytes.Contains(b, []byte("\r\n")) {
+		eol = "\r\n"
+	}
+	var (
+		lines, block []string
+		host         string // set by !host directive
+		seen         = make(map[string]bool)
+	)
+	flush := func() {
+		slices.SortStableFunc(block, func(a, b string) int {
+			return strings.Compare(strings.Fields(a)[0], strings.Fields(b)[0])
+		})
+		lines = append(lines, block...)
+		block = nil
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			flush()
+			if len(lines) > 0 && lines[len(lines)-1] != "" {
+				lines = append(lines, "")
+			}
+		case strings.HasPrefix(line, "#"):
+			flush()
+			lines = append(lines, line)
+		case strings.HasPrefix(line, "!"):
+			flush()
+			fields := strings.Fields(line[1:])
+			if len(fields) > 0 && fields[0] == "host" {
+				host = ""
+				if len(fields) > 1 {
+					host = strings.Trim(fields[1], "/")
+				}
+			}
+			lines = append(lines, "!"+strings.Join(fields, " "))
+		default:
+			fields := strings.Fields(line)
+			repo := fields[0]
+			if h, rest, ok := strings.Cut(repo, "/"); ok && h != "" {
+				repo = strings.ToLower(h) + "/" + rest
+			}
+			key := repo
+			if host != "" && !strings.Contains(repo, "/") {
+				key = host + "/" + repo
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			fields[0] = repo
+			block = append(block, strings.Join(fields, " "))
+		}
+	}
+	flush()
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, eol) + eol)
+}
@@ -0,0 +1,361 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// migrateSources are the supported tools and their default manifest files,
+// relative to the root.
+var migrateSources = []migrateSource{
+	{"repo-manifest", []string{".repo/manifest.xml", "default.xml"}},
+	{"myrepos", []string{".mrconfig"}},
+	{"vcstool", []string{"*.repos"}},
+	{"git-workspace", []string{"workspace-lock.toml"}},
+	{"gita", nil}, // in the user's config dir
+}
+
+type migrateSource struct {
+	name  string
+	files []string
+}
+
+// migratedRepo is a repo read from another tool's manifest.
+type migratedRepo struct {
+	path string // local path, relative to the root or absolute
+	url  string
+}
+
+type MigrateOptions struct {
+	From string // the tool, detected from the filename if empty
+	File string // the manifest, detected from the root if empty
+}
+
+// Migrate adds the repos in the manifest of another multi-repo tool to the
+// gitjoin.txt file in their parent directory.
+func Migrate(cfg Config, opts MigrateOptions) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	from, filename, err := s.detectMigrateSource(opts)
+	if err != nil {
+		return err
+	}
+	s.log("Migrating from %s (%s)\n", from, filename)
+
+	var repos []migratedRepo
+	switch from {
+	case "repo-manifest":
+		repos, err = readRepoManifest(filename)
+	case "myrepos":
+		repos, err = readMrconfig(filename)
+	case "vcstool":
+		repos, err = readVcstoolRepos(filename)
+	case "git-workspace":
+		repos, err = readGitWorkspaceLock(filename)
+	case "gita":
+		repos, err = s.readGitaRepos(filename)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	expected, err := s.collectAllRepos()
+	if err != nil {
+		return err
+	}
+	var migrated, skipped []RepoResult
+	byDir := make(map[string][]string)
+	for _, r := range repos {
+		localPath := r.path
+		if filepath.IsAbs(localPath) {
+			rel, err := filepath.Rel(cfg.Root, localPath)
+			if err != nil || !filepath.IsLocal(rel) {
+				skipped = append(skipped, RepoResult{Path: localPath, Detail: "outside of the root"})
+				continue
+			}
+			localPath = rel
+		}
+		localPath = path.Clean(filepath.ToSlash(localPath))
+		if _, found := expected[localPath]; found {
+			continue
+		}
+		if r.url == "" {
+			skipped = append(skipped, RepoResult{Path: localPath, Detail: "no origin remote"})
+			continue
+		}
+		repoPath, ok := urlToRepoPath(r.url)
+		if !ok {
+			skipped = append(skipped, RepoResult{Path: localPath, Detail: "unsupported URL " + r.url})
+			continue
+		}
+		if path.Base(repoPath) != path.Base(localPath) {
+			skipped = append(skipped, RepoResult{Path: localPath, Detail: "directory name differs from " + repoPath})
+			continue
+		}
+		dir := path.Dir(localPath)
+		byDir[dir] = append(byDir[dir], manifestLine(repoPath, r.url))
+		migrated = append(migrated, RepoResult{Path: localPath, Detail: repoPath})
+	}
+
+	for _, dir := range slices.Sorted(maps.Keys(byDir)) {
+		if err := os.MkdirAll(filepath.Join(cfg.Root, dir), 0o755); err != nil {
+			return err
+		}
+		if err := appendEntries(filepath.Join(cfg.Root, dir, "gitjoin.txt"), byDir[dir]); err != nil {
+			return err
+		}
+	}
+
+	s.printSections(
+		section{colorGreen, "Migrated", migrated},
+		section{colorYellow, "Skipped", skipped},
+	)
+	return nil
+}
+
+// detectMigrateSource returns the tool and the manifest filename to
+// migrate from.
+func (s *Syncer) detectMigrateSource(opts MigrateOptions) (from, filename string, err error) {
+	from, filename = opts.From, opts.File
+	if from != "" && !slices.ContainsFunc(migrateSources, func(src migrateSource) bool { return src.name == from }) {
+		return "", "", fmt.Errorf("unsupported -from %q, must be repo-manifest, gita, myrepos, vcstool or git-workspace", from)
+	}
+	if filename != "" {
+		if from == "" {
+			switch base := filepath.Base(filename); {
+			case strings.HasSuffix(base, ".xml"):
+				from = "repo-manifest"
+			case base == ".mrconfig":
+				from = "myrepos"
+			case strings.HasSuffix(base, ".repos"):
+				from = "vcstool"
+			case strings.HasSuffix(base, ".toml"):
+				from = "git-workspace"
+			case strings.HasSuffix(base, ".csv"):
+				from = "gita"
+			default:
+				return "", "", fmt.Errorf("can't detect the tool for %s, use -from", filename)
+			}
+		}
+		return from, filename, nil
+	}
+	for _, src := range migrateSources {
+		if from != "" && src.name != from {
+			continue
+		}
+		files := src.files
+		if src.name == "gita" {
+			if dir, err := os.UserConfigDir(); err == nil {
+				files = []string{filepath.Join(dir, "gita", "repos.csv")}
+			}
+		}
+		for _, pattern := range files {
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(s.Cfg.Root, pattern)
+			}
+			if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+				return src.name, matches[0], nil
+			}
+		}
+	}
+	if from != "" {
+		return "", "", fmt.Errorf("no %s manifest found, give the file as an argument", from)
+	}
+	return "", "", errors.New("no manifest of a supported tool found, use -from and give the file as an argument")
+}
+
+// readRepoManifest reads the projects in a manifest for Google's repo tool.
+func readRepoManifest(filename string) ([]migratedRepo, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var m struct {
+		Remotes []struct {
+			Name  string `xml:"name,attr"`
+			Fetch string `xml:"fetch,attr"`
+		} `xml:"remote"`
+		Default struct {
+			Remote string `xml:"remote,attr"`
+		} `xml:"default"`
+		Projects []struct {
+			Name   string `xml:"name,attr"`
+			Path   string `xml:"path,attr"`
+			Remote string `xml:"remote,attr"`
+		} `xml:"project"`
+	}
+	if err := xml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	fetch := make(map[string]string)
+	for _, r := range m.Remotes {
+		fetch[r.Name] = r.Fetch
+	}
+	var repos []migratedRepo
+	for _, p := range m.Projects {
+		base := fetch[cmp.Or(p.Remote, m.Default.Remote)]
+		if !strings.Contains(base, "://") && !strings.Contains(base, "@") {
+			return nil, fmt.Errorf("project %s: relative or missing remote fetch URL %q", p.Name, base)
+		}
+		repos = append(repos, migratedRepo{
+			path: cmp.Or(p.Path, p.Name),
+			url:  strings.TrimSuffix(base, "/") + "/" + p.Name,
+		})
+	}
+	return repos, nil
+}
+
+// readMrconfig reads the git repos in a myrepos .mrconfig file, i.e. the
+// sections with a checkout = git clone <url> <dir> command.
+func readMrconfig(filename string) ([]migratedRepo, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		repos   []migratedRepo
+		section string
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) != "checkout" || section == "" || section == "DEFAULT" {
+			continue
+		}
+		fields := strings.Fields(strings.NewReplacer("'", "", `"`, "").Replace(value))
+		i := slices.Index(fields, "clone")
+		if i < 1 || fields[i-1] != "git" || i+1 >= len(fields) {
+			continue
+		}
+		dir := section
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(filename), dir)
+		}
+		repos = append(repos, migratedRepo{path: dir, url: fields[i+1]})
+	}
+	return repos, scanner.Err()
+}
+
+// readVcstoolRepos reads the git repositories in a vcstool .repos file.
+// Only the subset of YAML used by vcstool is supported.
+func readVcstoolRepos(filename string) ([]migratedRepo, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		repos   []migratedRepo
+		current *migratedRepo
+		typ     string
+	)
+	add := func() {
+		if current != nil && current.url != "" && (typ == "" || typ == "git") {
+			repos = append(repos, *current)
+		}
+		current, typ = nil, ""
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "repositories:" {
+			continue
+		}
+		key, value, _ := strings.Cut(trimmed, ":")
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if value == "" && indent <= 2 {
+			add()
+			current = &migratedRepo{path: strings.Trim(key, `"'`)}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		switch key {
+		case "url":
+			current.url = value
+		case "type":
+			typ = value
+		}
+	}
+	add()
+	return repos, scanner.Err()
+}
+
+// readGitWorkspaceLock reads the repos in a git-workspace lock file.
+func readGitWorkspaceLock(filename string) ([]migratedRepo, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var lock struct {
+		Repo []struct {
+			Path string `toml:"path"`
+			URL  string `toml:"url"`
+		} `toml:"repo"`
+	}
+	if err := toml.Unmarshal(b, &lock); err != nil {
+		return nil, err
+	}
+	var repos []migratedRepo
+	for _, r := range lock.Repo {
+		repos = append(repos, migratedRepo{path: r.Path, url: r.URL})
+	}
+	return repos, nil
+}
+
+// readGitaRepos reads the repos in gita's repos.csv, with the URL taken
+// from the origin remote of each repo, if any.
+func (s *Syncer) readGitaRepos(filename string) ([]migratedRepo, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var repos []migratedRepo
+	for _, rec := range records {
+		if len(rec) == 0 || rec[0] == "" {
+			continue
+		}
+		repo := Repo{Path: rec[0], gitBin: s.Cfg.GitBin, gitArgs: s.Cfg.GitArgs, env: s.Cfg.gitEnv}
+		url, _ := repo.run("config", "remote.origin.url")
+		repos = append(repos, migratedRepo{path: rec[0], url: strings.TrimSpace(url)})
+	}
+	return repos, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// moved handles a clone or fetch of repo that the remote redirected to
+// redirect, which is how GitHub serves renamed and transferred repos. It
+// returns a note for the result. With -fix-manifest, the entry in the
+// gitjoin.txt file and the origin URL are updated to the new location.
+func (s *Syncer) moved(repo Repo, e entry, redirect string) (string, error) {
+	repoPath := movedTo(repo, e, redirect)
+	if repoPath == "" {
+		return "", nil
+	}
+	note := "moved to " + repoPath
+	if !s.Cfg.FixManifest {
+		return note + ", use -fix-manifest to update", nil
+	}
+	if path.Base(repoPath) != path.Base(e.Repo) {
+		return note + ", not updated as the directory name would change", nil
+	}
+	s.manifestMu.Lock()
+	_, err := setRepo(filepath.Join(s.Cfg.Root, e.File), e, repoPath)
+	s.manifestMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	url := s.ws.rewriteURL(repoPathToURL(repoPath, e.protocol()))
+	if _, err := repo.run("remote", "set-url", "origin", url); err != nil {
+		return "", err
+	}
+	return note + ", updated " + e.location(), nil
+}
+
+// movedTo maps the redirect URL back to a repo path, or returns "" if it
+// can't or the repo didn't move. The redirect is compared with the URL
+// git fetched from, after any insteadOf rewrites.
+func movedTo(repo Repo, e entry, redirect string) string {
+	fetched, err := repo.run("ls-remote", "--get-url", "origin")
+	if err != nil {
+		return ""
+	}
+	from, err1 := url.Parse(strings.TrimSpace(fetched))
+	to, err2 := url.Parse(redirect)
+	if err1 != nil || err2 != nil || from.Host != to.Host {
+		return ""
+	}
+	trim := func(p string) string {
+		return strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+	}
+	host, ownerRepo, _ := strings.Cut(e.Repo, "/")
+	prefix, ok := strings.CutSuffix(trim(from.Path), ownerRepo)
+	if !ok {
+		return ""
+	}
+	moved, ok := strings.CutPrefix(trim(to.Path), prefix)
+	if !ok || moved == ownerRepo {
+		return ""
+	}
+	repoPath := host + "/" + moved
+	if validateRepoPath(repoPath, e.Annotations["protocol"]) != nil {
+		return ""
+	}
+	return repoPath
+}
@@ -0,0 +1,149 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// attentionReasons are the skip reasons that need someone to look at the
+// repo before it can be synced again.
+var attentionReasons = []string{reasonManual, reasonInProgress, reasonDiverged, reasonUnverified}
+
+// notifier alerts about syncs that need attention when gitjoin runs
+// unattended: failed and removed repos, and repos needing manual work.
+type notifier struct {
+	webhook  string // Slack-compatible
+	email    string
+	smtpAddr string
+	client   *http.Client
+
+	last string // the text of the last alert, not repeated
+}
+
+func newNotifier(opts WatchOptions) *notifier {
+	return &notifier{
+		webhook:  opts.NotifyWebhook,
+		email:    opts.NotifyEmail,
+		smtpAddr: opts.SMTPAddr,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// notification is the JSON payload posted to the webhook. Slack shows
+// Text and ignores the rest.
+type notification struct {
+	Text      string        `json:"text"`
+	Root      string        `json:"root"`
+	Error     string        `json:"error,omitempty"`
+	Failed    []FailedRepo  `json:"failed,omitempty"`
+	Removed   []string      `json:"removed,omitempty"`
+	Attention []SkippedRepo `json:"attention,omitempty"`
+}
+
+// notify alerts about the result r of a sync of root that ended with err,
+// unless there's nothing to alert about or the alert is the same as the
+// last one.
+func (n *notifier) notify(root string, r Result, err error) error {
+	msg := newNotification(root, r, err)
+	if msg.Text == n.last {
+		return nil
+	}
+	n.last = msg.Text
+	if msg.Text == "" {
+		return nil
+	}
+	var errs []error
+	if n.webhook != "" {
+		errs = append(errs, n.post(msg))
+	}
+	if n.email != "" {
+		errs = append(errs, n.mail(msg))
+	}
+	return errors.Join(errs...)
+}
+
+func newNotification(root string, r Result, err error) notification {
+	msg := notification{Root: root, Failed: r.Failed, Removed: r.Removed}
+	for _, skip := range r.Skipped {
+		if slices.Contains(attentionReasons, skip.Reason) {
+			msg.Attention = append(msg.Attention, skip)
+		}
+	}
+	if err != nil && len(r.Failed) == 0 {
+		msg.Error = err.Error()
+	}
+
+	var lines, counts []string
+	if msg.Error != "" {
+		lines = append(lines, "error: "+msg.Error)
+	}
+	if n := len(msg.Failed); n > 0 {
+		counts = append(counts, fmt.Sprintf("%d failed", n))
+		for _, f := range msg.Failed {
+			lines = append(lines, fmt.Sprintf("- %s failed: %s: %s", f.Path, f.Stage, strings.Join(strings.Fields(f.Err), " ")))
+		}
+	}
+	if n := len(msg.Removed); n > 0 {
+		counts = append(counts, fmt.Sprintf("%d removed", n))
+		for _, p := range msg.Removed {
+			lines = append(lines, "- "+p+" removed")
+		}
+	}
+	if n := len(msg.Attention); n > 0 {
+		counts = append(counts, fmt.Sprintf("%d need attention", n))
+		for _, skip := range msg.Attention {
+			lines = append(lines, fmt.Sprintf("- %s: %s (%s)", skip.Path, skip.Reason, skip.Detail))
+		}
+	}
+	if len(lines) == 0 {
+		return msg
+	}
+	summary := "gitjoin sync of " + root
+	if len(counts) > 0 {
+		summary += ": " + strings.Join(counts, ", ")
+	}
+	msg.Text = summary + "\n" + strings.Join(lines, "\n")
+	return msg
+}
+
+func (n *notifier) post(msg notification) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.webhook, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// mail sends msg to n.email over SMTP, authenticating with SMTP_USERNAME
+// and SMTP_PASSWORD if set.
+func (n *notifier) mail(msg notification) error {
+	host, _ := os.Hostname()
+	from := "gitjoin@" + host
+	subject, body, _ := strings.Cut(msg.Text, "\n")
+	content := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", from, n.email, subject, strings.ReplaceAll(body, "\n", "\r\n"))
+	var auth smtp.Auth
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		smtpHost, _, _ := strings.Cut(n.smtpAddr, ":")
+		auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), smtpHost)
+	}
+	return smtp.SendMail(n.smtpAddr, auth, from, []string{n.email}, []byte(content))
+}
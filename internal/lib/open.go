@@ -0,0 +1,107 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Open opens the web page of the managed repo name, a local path, repo
+// path or directory name, in the browser, or prints its URL if print is
+// set. A repo on a non-default branch opens on that branch.
+func Open(cfg Config, name string, print bool) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+	localPath, err := findRepo(expected, name)
+	if err != nil {
+		return err
+	}
+	e := expected[localPath]
+	if e.Annotations["protocol"] == "file" {
+		return fmt.Errorf("%s: local repos have no web page", localPath)
+	}
+
+	url := "https://" + e.Repo
+	repo := s.repo(localPath)
+	if repo.IsGitRepo() {
+		branch, _ := repo.CurrentBranch()
+		if defaultBranch, err := repo.DefaultBranch(); err == nil && branch != "" && branch != defaultBranch {
+			url += branchURLPath(e.Repo, branch)
+		}
+	}
+
+	if print {
+		fmt.Fprintln(s.stdout, url)
+		return nil
+	}
+	return openBrowser(url)
+}
+
+// findRepo returns the local path of the managed repo name: a local path,
+// repo path or, if unambiguous, the name of the repo directory.
+func findRepo(expected map[string]entry, name string) (string, error) {
+	name = strings.TrimSuffix(filepath.ToSlash(filepath.Clean(name)), "/")
+	if _, found := expected[name]; found {
+		return name, nil
+	}
+	var matches []string
+	for localPath, e := range expected {
+		if e.Repo == name || path.Base(localPath) == name {
+			matches = append(matches, localPath)
+		}
+	}
+	slices.Sort(matches)
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%s: not a managed repo", name)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("%s is ambiguous: %s", name, strings.Join(matches, ", "))
+}
+
+// branchURLPath returns the path of the web page of branch, relative to
+// the repo page, in the URL scheme of the host of repoPath.
+func branchURLPath(repoPath, branch string) string {
+	host, _, _ := strings.Cut(repoPath, "/")
+	switch {
+	case strings.Contains(host, "gitlab"):
+		return "/-/tree/" + branch
+	case strings.Contains(host, "bitbucket"):
+		return "/src/" + branch
+	}
+	return "/tree/" + branch
+}
+
+// openBrowser opens url with $BROWSER or the system's default browser.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch {
+	case os.Getenv("BROWSER") != "":
+		cmd = exec.Command(os.Getenv("BROWSER"), url)
+	case runtime.GOOS == "darwin":
+		cmd = exec.Command("open", url)
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("open %s: %w: %s", url, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
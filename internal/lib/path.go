@@ -0,0 +1,98 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Path prints the absolute path of the managed repo best matching query
+// to stdout. The repos are looked up in the index saved by the last sync,
+// falling back to reading the gitjoin.txt files.
+func Path(cfg Config, query string) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	localPath := matchRepo(s.cache.Index, query)
+	if localPath == "" {
+		expected, err := s.collectExpectedRepos()
+		if err != nil {
+			return err
+		}
+		localPath = matchRepo(repoIndex(expected), query)
+	}
+	if localPath == "" {
+		return fmt.Errorf("no managed repo matches %q", query)
+	}
+	fmt.Fprintln(s.stdout, filepath.Join(s.Cfg.Root, filepath.FromSlash(localPath)))
+	return nil
+}
+
+// repoIndex maps the local paths in expected to their repo paths.
+func repoIndex(expected map[string]entry) map[string]string {
+	index := make(map[string]string, len(expected))
+	for localPath, e := range expected {
+		index[localPath] = e.Repo
+	}
+	return index
+}
+
+// matchRepo returns the local path in index best matching query, or ""
+// if none match. Exact matches of the directory name rank first, then
+// prefix and substring matches of it, then substring and subsequence
+// matches of the local or repo path. Ties go to the shortest path.
+func matchRepo(index map[string]string, query string) string {
+	q := strings.ToLower(filepath.ToSlash(query))
+	var (
+		best      string
+		bestScore = -1
+	)
+	for localPath, repoPath := range index {
+		score := matchScore(q, strings.ToLower(localPath), strings.ToLower(repoPath))
+		if score < 0 {
+			continue
+		}
+		if bestScore < 0 || score < bestScore ||
+			score == bestScore && (len(localPath) < len(best) || len(localPath) == len(best) && localPath < best) {
+			best, bestScore = localPath, score
+		}
+	}
+	return best
+}
+
+// matchScore returns how well q matches a repo, lower is better, or -1
+// if it doesn't match.
+func matchScore(q, localPath, repoPath string) int {
+	name := path.Base(localPath)
+	switch {
+	case name == q || localPath == q || repoPath == q:
+		return 0
+	case strings.HasPrefix(name, q):
+		return 1
+	case strings.Contains(name, q):
+		return 2
+	case strings.Contains(localPath, q) || strings.Contains(repoPath, q):
+		return 3
+	case isSubsequence(q, localPath) || isSubsequence(q, repoPath):
+		return 4
+	}
+	return -1
+}
+
+// isSubsequence reports whether the characters of q appear in s in order.
+func isSubsequence(q, s string) bool {
+	for _, r := range s {
+		if q == "" {
+			break
+		}
+		if strings.HasPrefix(q, string(r)) {
+			q = q[len(string(r)):]
+		}
+	}
+	return q == ""
+}
@@ -0,0 +1,245 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// SyncPlan is what a sync would do, worked out by Plan without touching
+// the network or the repos, so it can be reviewed before it's applied.
+type SyncPlan struct {
+	Root    string
+	Actions []PlanAction
+}
+
+// PlanAction is what a sync would do with the repo at Path: clone, pull,
+// remove or skip it.
+type PlanAction struct {
+	Path   string
+	Repo   string `json:",omitempty"`
+	Action string
+	Reason string `json:",omitempty"` // why the repo is skipped
+	Detail string `json:",omitempty"`
+}
+
+const (
+	actionClone  = "clone"
+	actionPull   = "pull"
+	actionRemove = "remove"
+	actionSkip   = "skip"
+)
+
+// Plan works out what a sync with cfg would do.
+func Plan(cfg Config) (SyncPlan, error) {
+	if err := cfg.validate(); err != nil {
+		return SyncPlan{}, err
+	}
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return SyncPlan{}, err
+	}
+	return s.plan()
+}
+
+// ShowPlan prints the plan for a sync with cfg to stdout, as JSON if
+// asJSON is set.
+func ShowPlan(cfg Config, asJSON bool) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	p, err := s.plan()
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		b, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(s.stdout, "%s\n", b)
+		return err
+	}
+	s.out = s.stdout
+	if len(p.Actions) == 0 {
+		s.log("Nothing to do\n")
+		return nil
+	}
+	byAction := make(map[string][]RepoResult)
+	skipped := make(map[string][]RepoResult)
+	for _, a := range p.Actions {
+		r := RepoResult{Path: a.Path, Detail: a.Detail}
+		if a.Action == actionSkip {
+			skipped[a.Reason] = append(skipped[a.Reason], r)
+		} else {
+			byAction[a.Action] = append(byAction[a.Action], r)
+		}
+	}
+	sections := []section{
+		{colorGreen, "Clone", byAction[actionClone]},
+		{colorGreen, "Pull", byAction[actionPull]},
+		{colorYellow, "Remove", byAction[actionRemove]},
+	}
+	for _, reason := range slices.Sorted(maps.Keys(skipped)) {
+		sections = append(sections, section{colorYellow, "Skip (" + reason + ")", skipped[reason]})
+	}
+	s.printSections(sections...)
+	return nil
+}
+
+// LoadPlan reads a plan written by ShowPlan as JSON.
+func LoadPlan(filename string) (SyncPlan, error) {
+	var p SyncPlan
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return p, fmt.Errorf("%s: %w", filename, err)
+	}
+	return p, nil
+}
+
+// Apply carries out the clones, pulls and removals of p. Each repo is
+// checked again as it's synced, so one that changed since the plan was
+// made is skipped rather than overwritten.
+func Apply(cfg Config, p SyncPlan) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	if p.Root != s.Cfg.Root {
+		return fmt.Errorf("plan is for %s, not %s", p.Root, s.Cfg.Root)
+	}
+	s.planned = make(map[string]string)
+	for _, a := range p.Actions {
+		if a.Action != actionSkip {
+			s.planned[a.Path] = a.Action
+		}
+	}
+	_, err = s.sync()
+	return err
+}
+
+func (s *Syncer) plan() (SyncPlan, error) {
+	p := SyncPlan{Root: s.Cfg.Root}
+	t, err := s.walk()
+	if err != nil {
+		return p, err
+	}
+	expected, err := s.expectedRepos(t)
+	if err != nil {
+		return p, err
+	}
+	for _, localPath := range slices.Sorted(maps.Keys(expected)) {
+		a, err := s.planRepo(localPath, expected[localPath])
+		if err != nil {
+			return p, err
+		}
+		if a.Action != "" {
+			a.Path, a.Repo = localPath, expected[localPath].Repo
+			p.Actions = append(p.Actions, a)
+		}
+	}
+	if !s.Cfg.OnlyClone && !s.Cfg.OnlyUpdate && !s.Cfg.Offline && s.seesAll() {
+		unmanaged, err := s.unmanaged(t, expected)
+		if err != nil {
+			return p, err
+		}
+		for _, localPath := range unmanaged {
+			p.Actions = append(p.Actions, PlanAction{Path: localPath, Action: actionRemove})
+		}
+	}
+	return p, nil
+}
+
+// planRepo makes the checks of processRepo that don't need the network.
+// A repo that turns out to have diverged is still skipped when applied.
+func (s *Syncer) planRepo(localPath string, e entry) (PlanAction, error) {
+	skip := func(reason, detail string) (PlanAction, error) {
+		return PlanAction{Action: actionSkip, Reason: reason, Detail: detail}, nil
+	}
+	if e.has("off") {
+		return skip(reasonDisabled, "")
+	}
+	repo := s.repo(localPath)
+	if _, err := os.Stat(repo.Path); os.IsNotExist(err) {
+		switch {
+		case s.Cfg.OnlyUpdate:
+			return PlanAction{}, nil
+		case s.Cfg.Offline:
+			return skip(reasonOffline, "not cloned")
+		}
+		return PlanAction{Action: actionClone}, nil
+	}
+	if s.Cfg.OnlyClone {
+		return PlanAction{}, nil
+	}
+	if !repo.IsGitRepo() {
+		if s.Cfg.Repair {
+			return PlanAction{Action: actionClone, Detail: "repair"}, nil
+		}
+		return skip("not a git repo", "use -repair to re-clone")
+	}
+	if op := repo.Operation(); op != "" {
+		return skip(reasonInProgress, op)
+	}
+	defaultBranch, err := repo.DefaultBranch()
+	if err != nil {
+		return PlanAction{}, fmt.Errorf("%s: %w", localPath, err)
+	}
+	st, err := repo.Status()
+	if err != nil {
+		return PlanAction{}, fmt.Errorf("%s: status: %w", localPath, err)
+	}
+	if sha := e.Annotations["freeze"]; sha != "" {
+		return skip(reasonFrozen, "at "+sha[:min(len(sha), 7)])
+	}
+	if s.Cfg.Offline {
+		return skip(reasonOffline, "not pulled")
+	}
+	if e.has("latest-tag") && !st.dirty() {
+		out, _ := repo.run("tag", "--points-at", "HEAD")
+		if st.Branch == defaultBranch || st.Branch == "" && strings.TrimSpace(out) != "" {
+			return PlanAction{Action: actionPull, Detail: "newest release tag"}, nil
+		}
+	}
+	if !s.Cfg.Force {
+		switch {
+		case st.dirty():
+			return skip(reasonUncommitted, st.summary())
+		case st.Branch == "":
+			return skip(reasonDetached, "at "+st.Head[:min(len(st.Head), 7)])
+		case st.Branch != defaultBranch:
+			return skip(reasonNonDefault, "on "+st.Branch)
+		}
+		return PlanAction{Action: actionPull}, nil
+	}
+	if s.Cfg.MaxStash > 0 && len(st.Changes) > s.Cfg.MaxStash {
+		return skip(reasonManual, fmt.Sprintf("%d changed files, more than -max-stash %d", len(st.Changes), s.Cfg.MaxStash))
+	}
+	if st.Branch == "" && !repo.IsOnBranch("HEAD") {
+		return skip(reasonDetached, "at "+st.Head[:min(len(st.Head), 7)]+", commits not on any branch")
+	}
+	var steps []string
+	if st.dirty() {
+		steps = append(steps, "stash "+st.summary())
+	}
+	if st.Branch != defaultBranch {
+		steps = append(steps, "switch to "+defaultBranch)
+	}
+	return PlanAction{Action: actionPull, Detail: strings.Join(steps, ", ")}, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type PROptions struct {
+	Title string
+	Body  string
+}
+
+// CreatePRs opens a GitHub pull request for every managed GitHub repo
+// whose current branch is pushed, isn't the default branch and has
+// commits the default branch doesn't.
+// The token is read from GITHUB_TOKEN or GH_TOKEN.
+func CreatePRs(cfg Config, opts PROptions) error {
+	if opts.Title == "" {
+		return errors.New("pull request title required (-title)")
+	}
+	token := cmp.Or(os.Getenv("GITHUB_TOKEN"), os.Getenv("GH_TOKEN"))
+	if token == "" {
+		return errors.New("GITHUB_TOKEN or GH_TOKEN must be set")
+	}
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+
+	gh := newGithubClient(token)
+	var (
+		mu                                   sync.Mutex
+		opened, notPushed, noCommits, failed []RepoResult
+	)
+	add := func(results *[]RepoResult, r RepoResult) {
+		mu.Lock()
+		*results = append(*results, r)
+		mu.Unlock()
+	}
+	err = s.forEachRepo(slices.Collect(maps.Keys(expected)), func(localPath string) error {
+		e := expected[localPath]
+		repo := s.repo(localPath)
+		host, ownerRepo, _ := strings.Cut(e.Repo, "/")
+		if host != "github.com" || e.has("off") || e.has("readonly") || !repo.IsGitRepo() {
+			return nil
+		}
+		branch, err := repo.CurrentBranch()
+		if err != nil {
+			return fmt.Errorf("%s: get current branch: %w", localPath, err)
+		}
+		base, err := repo.DefaultBranch()
+		if err != nil {
+			return fmt.Errorf("%s: get default branch: %w", localPath, err)
+		}
+		if branch == "" || branch == base {
+			return nil
+		}
+		if !repo.HasRemoteBranch(branch) {
+			add(&notPushed, RepoResult{Path: localPath, Detail: branch})
+			return nil
+		}
+		ahead, _, err := repo.AheadBehind(branch, "origin/"+base)
+		if err != nil {
+			return fmt.Errorf("%s: count commits ahead of %s: %w", localPath, base, err)
+		}
+		if ahead == 0 {
+			add(&noCommits, RepoResult{Path: localPath, Detail: branch})
+			return nil
+		}
+		url, err := gh.createPR(ownerRepo, branch, base, opts)
+		if err != nil {
+			add(&failed, RepoResult{Path: localPath, Detail: err.Error()})
+			return nil
+		}
+		add(&opened, RepoResult{Path: localPath, Detail: url})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	byPath := func(a, b RepoResult) int { return strings.Compare(a.Path, b.Path) }
+	slices.SortFunc(opened, byPath)
+	slices.SortFunc(notPushed, byPath)
+	slices.SortFunc(noCommits, byPath)
+	slices.SortFunc(failed, byPath)
+	s.printSections(
+		section{colorGreen, "Opened pull requests", opened},
+		section{colorYellow, "Skipped (not pushed)", notPushed},
+		section{colorYellow, "Skipped (no commits)", noCommits},
+		section{colorRed, "Failed", failed},
+	)
+	if len(failed) > 0 {
+		return fmt.Errorf("%d pull requests failed", len(failed))
+	}
+	return nil
+}
+
+type githubClient struct {
+	api    string
+	token  string
+	client *http.Client
+}
+
+func newGithubClient(token string) *githubClient {
+	return &githubClient{
+		api:    strings.TrimSuffix(cmp.Or(os.Getenv("GITHUB_API_URL"), "https://api.github.com"), "/"),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// createPR opens a pull request in ownerRepo, e.g. bep/hugo, and returns its URL.
+func (c *githubClient) createPR(ownerRepo, head, base string, opts PROptions) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"title": opts.Title,
+		"body":  opts.Body,
+		"head":  head,
+		"base":  base,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", c.api+"/repos/"+ownerRepo+"/pulls", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		HTMLURL string `json:"html_url"`
+		Message string `json:"message"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		msg := result.Message
+		for _, e := range result.Errors {
+			msg += ": " + e.Message
+		}
+		return "", fmt.Errorf("%s: %s", resp.Status, msg)
+	}
+	return result.HTMLURL, nil
+}
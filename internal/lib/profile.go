@@ -0,0 +1,34 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+const profileTop = 10
+
+func (s *Syncer) printProfile(r Result) {
+	var total, cpu time.Duration
+	for _, t := range r.Timings {
+		total += t.Wall
+		cpu += t.CPU
+	}
+	s.header(colorGreen, "Profile: %s wall, %s in repos, %s git CPU",
+		r.Duration.Round(time.Millisecond), total.Round(time.Millisecond), cpu.Round(time.Millisecond))
+
+	timings := slices.Clone(r.Timings)
+	slices.SortFunc(timings, func(a, b Timing) int { return cmp.Compare(b.Wall, a.Wall) })
+	timings = timings[:min(len(timings), profileTop)]
+	var slowest []RepoResult
+	for _, t := range timings {
+		slowest = append(slowest, RepoResult{
+			Path:   t.Path,
+			Detail: t.Wall.Round(time.Millisecond).String() + ", cpu " + t.CPU.Round(time.Millisecond).String(),
+		})
+	}
+	s.printSections(section{colorGreen, "Slowest", slowest})
+}
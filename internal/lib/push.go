@@ -0,0 +1,102 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type PushOptions struct {
+	DryRun bool
+}
+
+// Push pushes the default branch of all managed repos with unpushed commits.
+// Branches that can't be fast-forwarded on origin are skipped, and repos
+// that fail are reported without stopping the others.
+func Push(cfg Config, opts PushOptions) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+
+	var (
+		mu                                 sync.Mutex
+		pushed, rejected, readonly, failed []RepoResult
+	)
+	add := func(results *[]RepoResult, r RepoResult) {
+		mu.Lock()
+		*results = append(*results, r)
+		mu.Unlock()
+	}
+	err = s.forEachRepo(slices.Collect(maps.Keys(expected)), func(localPath string) error {
+		repo := s.repo(localPath)
+		if expected[localPath].has("off") || !repo.IsGitRepo() {
+			return nil
+		}
+		fail := func(stage string, err error) error {
+			add(&failed, RepoResult{Path: localPath, Detail: stage + ": " + strings.Join(strings.Fields(err.Error()), " ")})
+			return nil
+		}
+		branch, err := repo.DefaultBranch()
+		if err != nil {
+			return fail("get default branch", err)
+		}
+		if _, err := repo.run("fetch", "origin", branch); err != nil {
+			return fail("fetch", err)
+		}
+		ahead, behind, err := repo.AheadBehind(branch, "origin/"+branch)
+		if err != nil {
+			return fail("count commits", err)
+		}
+		if ahead == 0 {
+			return nil
+		}
+		if expected[localPath].has("readonly") {
+			add(&readonly, RepoResult{Path: localPath, Detail: fmt.Sprintf("%s, %d commits", branch, ahead)})
+			return nil
+		}
+		if behind > 0 {
+			add(&rejected, RepoResult{Path: localPath, Detail: fmt.Sprintf("%d ahead, %d behind", ahead, behind)})
+			return nil
+		}
+		if !opts.DryRun {
+			if _, err := repo.run("push", "origin", branch); err != nil {
+				return fail("push", err)
+			}
+		}
+		add(&pushed, RepoResult{Path: localPath, Detail: fmt.Sprintf("%s, %d commits", branch, ahead)})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	byPath := func(a, b RepoResult) int { return strings.Compare(a.Path, b.Path) }
+	slices.SortFunc(pushed, byPath)
+	slices.SortFunc(rejected, byPath)
+	slices.SortFunc(readonly, byPath)
+	slices.SortFunc(failed, byPath)
+	title := "Pushed"
+	if opts.DryRun {
+		title = "Would push"
+	}
+	s.printSections(
+		section{colorGreen, title, pushed},
+		section{colorYellow, "Skipped (non-fast-forward)", rejected},
+		section{colorYellow, "Skipped (read-only)", readonly},
+		section{colorRed, "Failed", failed},
+	)
+	if len(failed) > 0 {
+		return fmt.Errorf("%d pushes failed", len(failed))
+	}
+	return nil
+}
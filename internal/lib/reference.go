@@ -0,0 +1,77 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// referenceStore is a bare repo holding the objects of all cloned repos,
+// used with git clone --reference-if-able so forks of the same repo share
+// their objects.
+type referenceStore struct {
+	repo Repo
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex // by repo path, nil until the store is set up
+}
+
+// expandPath expands a leading ~/ in dir to the home directory and makes
+// relative paths relative to root.
+func expandPath(dir, root string) (string, error) {
+	if rest, found := strings.CutPrefix(dir, "~/"); found {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, rest), nil
+	}
+	if !filepath.IsAbs(dir) {
+		return filepath.Join(root, dir), nil
+	}
+	return dir, nil
+}
+
+// add fetches the branches of url into the store, with refs under
+// refs/remotes/<repoPath>/. Different repos are fetched in parallel.
+func (rs *referenceStore) add(repoPath, url string) error {
+	rs.mu.Lock()
+	if rs.locks == nil {
+		if err := rs.init(); err != nil {
+			rs.mu.Unlock()
+			return err
+		}
+		rs.locks = make(map[string]*sync.Mutex)
+	}
+	l := rs.locks[repoPath]
+	if l == nil {
+		l = new(sync.Mutex)
+		rs.locks[repoPath] = l
+	}
+	rs.mu.Unlock()
+
+	l.Lock()
+	defer l.Unlock()
+	_, err := rs.repo.run("fetch", "--no-tags", "--quiet", url, "+refs/heads/*:refs/remotes/"+repoPath+"/*")
+	return err
+}
+
+// init creates the store if it doesn't exist.
+func (rs *referenceStore) init() error {
+	if _, err := os.Stat(filepath.Join(rs.repo.Path, "HEAD")); !os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.MkdirAll(rs.repo.Path, 0o755); err != nil {
+		return err
+	}
+	if _, err := rs.repo.run("init", "--bare", "--quiet"); err != nil {
+		return err
+	}
+	// Pruning objects would corrupt the clones borrowing them.
+	_, err := rs.repo.run("config", "gc.auto", "0")
+	return err
+}
@@ -0,0 +1,174 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+const stateFile = ".gitjoin/state"
+
+// state is kept between runs.
+type state struct {
+	Failed []FailedRepo
+}
+
+func loadState(root string) (state, error) {
+	var st state
+	b, err := os.ReadFile(filepath.Join(root, stateFile))
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	return st, json.Unmarshal(b, &st)
+}
+
+// saveState writes st to the state file, removing it if there's nothing
+// to keep.
+func saveState(root string, st state) error {
+	filename := filepath.Join(root, stateFile)
+	if len(st.Failed) == 0 {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, append(b, '\n'), 0o644)
+}
+
+// SyncRepo syncs only the managed repo name, see findRepo, leaving all
+// other repos alone. found is false, and nothing is done, if name is a
+// directory that's not a managed repo, e.g. a root to sync.
+//
+// A clone, or a shorthand for a repo synced before, found in the index of
+// the last sync, has its entry read from the gitjoin.txt above it, without
+// walking the root. Other shorthands need a walk.
+func SyncRepo(cfg Config, name string) (found bool, err error) {
+	fi, err := os.Stat(name)
+	isDir := err == nil && fi.IsDir()
+	if isDir && !(Repo{Path: name}).IsGitRepo() {
+		return false, nil
+	}
+	if err := cfg.validate(); err != nil {
+		return false, err
+	}
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return false, err
+	}
+	syncOnly := func(localPath string, e entry) (bool, error) {
+		s.retry = map[string]bool{localPath: true}
+		s.only = map[string]entry{localPath: e}
+		_, err := s.sync()
+		return true, err
+	}
+
+	if isDir {
+		// A clone, listed in the gitjoin.txt above it, or a root.
+		root, _ := filepath.Abs(s.Cfg.Root)
+		dir, _ := filepath.Abs(name)
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || rel == "." || !filepath.IsLocal(rel) {
+			return false, nil
+		}
+		localPath := filepath.ToSlash(rel)
+		e, found, err := s.manifestEntry(localPath)
+		if err != nil || !found {
+			return false, err
+		}
+		return syncOnly(localPath, e)
+	}
+
+	// A shorthand, or a repo not cloned yet.
+	index := make(map[string]entry)
+	for localPath, repoPath := range s.cache.Index {
+		index[localPath] = entry{Repo: repoPath}
+	}
+	if localPath, err := findRepo(index, name); err == nil {
+		e, found, err := s.manifestEntry(localPath)
+		if err != nil {
+			return true, err
+		}
+		if found {
+			return syncOnly(localPath, e)
+		}
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return false, err
+	}
+	localPath, err := findRepo(expected, name)
+	if err != nil {
+		return false, err
+	}
+	s.retry = map[string]bool{localPath: true}
+	_, err = s.sync()
+	return true, err
+}
+
+// manifestEntry returns the entry of the repo at localPath in the nearest
+// gitjoin.txt above it, if listed there.
+func (s *Syncer) manifestEntry(localPath string) (entry, bool, error) {
+	if err := s.checkRoot(); err != nil {
+		return entry{}, false, err
+	}
+	for dir := path.Dir(localPath); ; dir = path.Dir(dir) {
+		manifest := path.Join(dir, "gitjoin.txt")
+		if _, err := os.Stat(filepath.Join(s.Cfg.Root, manifest)); err == nil {
+			if err := s.verifyManifest(manifest); err != nil {
+				return entry{}, false, err
+			}
+			entries, _, err := parseGitjoinFile(s.Cfg.Root, manifest)
+			if err != nil {
+				return entry{}, false, err
+			}
+			for i, p := range localPaths(dir, entries, s.Cfg.Disambiguate) {
+				if p == localPath {
+					return entries[i], true, nil
+				}
+			}
+			return entry{}, false, nil
+		}
+		if dir == "." {
+			return entry{}, false, nil
+		}
+	}
+}
+
+// Retry syncs the repos that failed in the last run.
+func Retry(cfg Config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	st, err := loadState(cfg.Root)
+	if err != nil {
+		return err
+	}
+	if len(st.Failed) == 0 {
+		s.log("No failed repos to retry\n")
+		return nil
+	}
+	s.retry = make(map[string]bool)
+	for _, f := range st.Failed {
+		s.retry[f.Path] = true
+	}
+	_, err = s.sync()
+	return err
+}
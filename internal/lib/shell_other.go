@@ -0,0 +1,13 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !windows
+
+package lib
+
+import "os/exec"
+
+// shellCommand returns a command running command with sh -c.
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("sh", "-c", command)
+}
@@ -0,0 +1,22 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"cmp"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// shellCommand returns a command running command with cmd /C, or the
+// shell in COMSPEC.
+func shellCommand(command string) *exec.Cmd {
+	shell := cmp.Or(os.Getenv("COMSPEC"), "cmd.exe")
+	cmd := exec.Command(shell)
+	// cmd doesn't unquote its arguments like other programs, so command is
+	// passed as is.
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: syscall.EscapeArg(shell) + ` /S /C "` + command + `"`}
+	return cmd
+}
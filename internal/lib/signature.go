@@ -0,0 +1,81 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// sshSignatureNamespace is the namespace of SSH signatures of gitjoin.txt
+// files, i.e. ssh-keygen -Y sign -n gitjoin.
+const sshSignatureNamespace = "gitjoin"
+
+// verifyManifest verifies the detached signature in manifest.sig of the
+// gitjoin.txt file manifest, relative to the root, if
+// -manifest-allowed-signers or -manifest-gpg-keyring is set.
+func (s *Syncer) verifyManifest(manifest string) error {
+	allowedSigners, keyring := s.Cfg.ManifestAllowedSigners, s.Cfg.ManifestGPGKeyring
+	if allowedSigners == "" && keyring == "" {
+		return nil
+	}
+	filename := filepath.Join(s.Cfg.Root, manifest)
+	sig, err := os.ReadFile(filename + ".sig")
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s: missing signature %s.sig", manifest, manifest)
+	}
+	if err != nil {
+		return err
+	}
+
+	var cmds [][]string
+	if bytes.HasPrefix(sig, []byte("-----BEGIN SSH SIGNATURE-----")) {
+		if allowedSigners == "" {
+			return fmt.Errorf("%s: SSH signature, but no -manifest-allowed-signers given", manifest)
+		}
+		allowed, err := expandPath(allowedSigners, "")
+		if err != nil {
+			return err
+		}
+		out, err := exec.Command("ssh-keygen", "-Y", "find-principals", "-f", allowed, "-s", filename+".sig").Output()
+		if err != nil {
+			return fmt.Errorf("%s: signature verification failed: no allowed signer", manifest)
+		}
+		principal, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		cmds = append(cmds, []string{"ssh-keygen", "-Y", "verify", "-f", allowed, "-I", principal, "-n", sshSignatureNamespace, "-s", filename + ".sig"})
+	} else {
+		if keyring == "" {
+			return fmt.Errorf("%s: GPG signature, but no -manifest-gpg-keyring given", manifest)
+		}
+		keyring, err := expandPath(keyring, "")
+		if err != nil {
+			return err
+		}
+		cmds = append(cmds, []string{"gpgv", "--keyring", keyring, filename + ".sig", filename})
+	}
+
+	for _, args := range cmds {
+		cmd := exec.Command(args[0], args[1:]...)
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		cmd.Stdin = f
+		out, err := cmd.CombinedOutput()
+		f.Close()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				return err
+			}
+			return fmt.Errorf("%s: signature verification failed: %s", manifest, strings.Join(strings.Fields(string(out)), " "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+)
+
+// Stashes lists the stashes created by gitjoin -force in all managed repos.
+func Stashes(cfg Config) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(s.stdout, 0, 4, 2, ' ', 0)
+	for _, localPath := range slices.Sorted(maps.Keys(expected)) {
+		repo := s.repo(localPath)
+		if !repo.IsGitRepo() {
+			continue
+		}
+		stashes, err := repo.Stashes()
+		if err != nil {
+			return fmt.Errorf("%s: %w", localPath, err)
+		}
+		for _, stash := range stashes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", localPath, stash.Ref, stash.Subject, stash.Date)
+		}
+	}
+	return w.Flush()
+}
+
+// Unstash pops the newest stash created by gitjoin -force in the managed
+// repo at localPath.
+func Unstash(cfg Config, localPath string) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+	localPath = filepath.ToSlash(filepath.Clean(localPath))
+	if _, found := expected[localPath]; !found {
+		return fmt.Errorf("%s: not a managed repo", localPath)
+	}
+
+	repo := s.repo(localPath)
+	stashes, err := repo.Stashes()
+	if err != nil {
+		return fmt.Errorf("%s: %w", localPath, err)
+	}
+	if len(stashes) == 0 {
+		return fmt.Errorf("%s: no gitjoin stashes", localPath)
+	}
+	if err := repo.PopStash(stashes[0].Ref); err != nil {
+		return fmt.Errorf("%s: %w", localPath, err)
+	}
+	s.log("Unstashed %s in %s\n", stashes[0].Ref, localPath)
+	return nil
+}
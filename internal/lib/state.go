@@ -0,0 +1,104 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// reuseState reports whether the outcome of the last sync of the repo of
+// e may be reused if neither the repo nor its remote has changed since.
+// Options that look beyond the local repo and its remote branches turn
+// it off.
+func (s *Syncer) reuseState(e entry) bool {
+	c := s.Cfg
+	if c.Force || c.Offline || c.PruneBranches || c.CheckArchived || c.Tags || c.VerifySignatures {
+		return false
+	}
+	return !e.has("tags") && !e.has("verify-signatures") && !e.has("latest-tag")
+}
+
+// fingerprint identifies the state of repo, its checked out commit, its
+// remote branches, its index and its entry e, fetching from origin first
+// if fetch is set. It's read from the files in .git, without running git.
+// A fetch that was redirected gives no fingerprint, so the move is
+// reported.
+func (s *Syncer) fingerprint(repo Repo, e entry, fetch bool) (string, error) {
+	if fetch {
+		if redirect, err := repo.fetch(); err != nil || redirect != "" {
+			return "", err
+		}
+	}
+	gitDir := filepath.Join(repo.Path, ".git")
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	headRef, _ := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: ")
+	h := sha256.New()
+	fmt.Fprintln(h, e.Repo, s.ws.Config, s.ws.Identities)
+	for _, k := range slices.Sorted(maps.Keys(e.Annotations)) {
+		fmt.Fprintln(h, k, e.Annotations[k])
+	}
+	fmt.Fprintf(h, "%s", head)
+	for _, name := range []string{"config", "index"} {
+		if fi, err := os.Stat(filepath.Join(gitDir, name)); err == nil {
+			fmt.Fprintln(h, name, fi.ModTime(), fi.Size())
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(gitDir, headRef)); err == nil {
+		fmt.Fprintf(h, "%s %s", headRef, b)
+	}
+	packed, err := os.ReadFile(filepath.Join(gitDir, "packed-refs"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	for line := range strings.SplitSeq(string(packed), "\n") {
+		if _, ref, _ := strings.Cut(line, " "); ref == headRef || strings.HasPrefix(ref, "refs/remotes/origin/") {
+			fmt.Fprintln(h, line)
+		}
+	}
+	origin := filepath.Join(gitDir, "refs", "remotes", "origin")
+	err = filepath.WalkDir(origin, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %s", filepath.ToSlash(p[len(origin):]), b)
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// outcome passes events on, recording whether the repo was skipped or
+// failed.
+type outcome struct {
+	Events
+	skip   *SkippedRepo
+	failed bool
+}
+
+func (o *outcome) OnSkip(r SkippedRepo) {
+	o.skip = &r
+	o.Events.OnSkip(r)
+}
+
+func (o *outcome) OnFail(r FailedRepo) {
+	o.failed = true
+	o.Events.OnFail(r)
+}
@@ -0,0 +1,122 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// statsTop is the number of repos and extensions listed in the stats.
+const statsTop = 10
+
+// Stats prints an overview of the workspace to stdout: the managed repos
+// by host and owner, the commits pulled by the last sync, the most active
+// repos of the last week and the tracked files by extension.
+func Stats(cfg Config) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+	runs, err := loadHistory(cfg.Root)
+	if err != nil {
+		return err
+	}
+
+	hosts := make(map[string]int)
+	owners := make(map[string]int)
+	for _, e := range expected {
+		host, _, _ := strings.Cut(e.Repo, "/")
+		hosts[host]++
+		owners[path.Dir(e.Repo)]++
+	}
+
+	var (
+		mu     sync.Mutex
+		active = make(map[string]int)
+		exts   = make(map[string]int)
+	)
+	err = s.forEachRepo(slices.Collect(maps.Keys(expected)), func(localPath string) error {
+		repo := s.repo(localPath)
+		if !repo.IsGitRepo() {
+			return nil
+		}
+		// Fails in a repo without commits, which has none to count.
+		out, _ := repo.run("rev-list", "--count", "--since=1.week.ago", "HEAD")
+		commits, _ := strconv.Atoi(strings.TrimSpace(out))
+		files, err := repo.run("ls-files", "-z")
+		if err != nil {
+			return fmt.Errorf("%s: %w", localPath, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if commits > 0 {
+			active[localPath] = commits
+		}
+		for f := range strings.SplitSeq(files, "\x00") {
+			if f == "" {
+				continue
+			}
+			ext := path.Ext(f)
+			if ext == "" {
+				ext = "(none)"
+			}
+			exts[ext]++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(s.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Repos: %d\n", len(expected))
+	for _, host := range top(hosts, len(hosts)) {
+		fmt.Fprintf(w, "  %s\t%d\n", host, hosts[host])
+	}
+	fmt.Fprintf(w, "Owners:\n")
+	for _, owner := range top(owners, len(owners)) {
+		fmt.Fprintf(w, "  %s\t%d\n", owner, owners[owner])
+	}
+	if len(runs) > 0 {
+		last := runs[len(runs)-1]
+		var pulled int
+		for _, r := range last.Updated {
+			pulled += r.Commits
+		}
+		fmt.Fprintf(w, "Last sync: %s, %d commits pulled\n", last.Time.Format("2006-01-02 15:04"), pulled)
+	}
+	if len(active) > 0 {
+		fmt.Fprintf(w, "Most active in the last week:\n")
+		for _, localPath := range top(active, statsTop) {
+			fmt.Fprintf(w, "  %s\t%d commits\n", localPath, active[localPath])
+		}
+	}
+	if len(exts) > 0 {
+		fmt.Fprintf(w, "Files by extension:\n")
+		for _, ext := range top(exts, statsTop) {
+			fmt.Fprintf(w, "  %s\t%d\n", ext, exts[ext])
+		}
+	}
+	return w.Flush()
+}
+
+// top returns the at most n keys of m with the highest counts.
+func top(m map[string]int, n int) []string {
+	keys := slices.SortedFunc(maps.Keys(m), func(a, b string) int {
+		return cmp.Or(cmp.Compare(m[b], m[a]), cmp.Compare(a, b))
+	})
+	return keys[:min(n, len(keys))]
+}
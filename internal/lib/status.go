@@ -0,0 +1,84 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Status prints the state of all managed repos to stdout.
+func Status(cfg Config) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(s.stdout, 0, 4, 2, ' ', 0)
+	for _, localPath := range slices.Sorted(maps.Keys(expected)) {
+		branch, state, err := s.describe(localPath)
+		if err != nil {
+			return err
+		}
+		if expected[localPath].has("off") {
+			state += ", disabled"
+		}
+		if sha := expected[localPath].Annotations["freeze"]; sha != "" {
+			state += ", frozen at " + sha[:min(len(sha), 7)]
+		}
+		if branch == "" {
+			fmt.Fprintf(w, "%s\t%s\n", localPath, state)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", localPath, branch, state)
+		}
+	}
+	return w.Flush()
+}
+
+// RepoPaths returns the sorted local paths of all managed repos.
+func RepoPaths(cfg Config) ([]string, error) {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(expected)), nil
+}
+
+// describe returns the current branch and a short description of the
+// state of the repo at localPath.
+func (s *Syncer) describe(localPath string) (branch, state string, err error) {
+	repo := s.repo(localPath)
+	if !repo.IsGitRepo() {
+		return "", "not cloned", nil
+	}
+	st, err := repo.Status()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: status: %w", localPath, err)
+	}
+	notes := []string{st.summary()}
+	if filter := repo.PartialCloneFilter(); filter != "" {
+		notes = append(notes, "partial clone ("+filter+")")
+	}
+	if repo.SingleBranch() {
+		notes = append(notes, "single branch")
+	}
+	if k := detectKind(repo.Path); k.Lang != "" {
+		notes = append(notes, k.String())
+	}
+	if stashes, _ := repo.Stashes(); len(stashes) > 0 {
+		notes = append(notes, fmt.Sprintf("%d gitjoin stashes", len(stashes)))
+	}
+	return st.Branch, strings.Join(notes, ", "), nil
+}
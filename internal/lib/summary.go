@@ -0,0 +1,170 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type summary struct {
+	Result
+	Groups []resultGroup `json:",omitempty"` // set with Config.GroupBy
+	Error  string        `json:",omitempty"`
+}
+
+// writeSummary writes a report of the sync to the configured summary file.
+func (s *Syncer) writeSummary(r Result, runErr error) error {
+	filename, format := s.Cfg.SummaryFile, s.Cfg.SummaryFormat
+	if format == "" {
+		format = "md"
+		if filepath.Ext(filename) == ".json" {
+			format = "json"
+		}
+	}
+	if filename == "" && format == "github" {
+		filename = os.Getenv("GITHUB_STEP_SUMMARY")
+	}
+	if filename == "" {
+		return errors.New("no summary file set")
+	}
+
+	var content []byte
+	switch format {
+	case "json":
+		var err error
+		if content, err = s.jsonSummary(r, runErr); err != nil {
+			return err
+		}
+	default:
+		var groups []resultGroup
+		if s.Cfg.GroupBy != "" {
+			groups = r.groups(s.Cfg.GroupBy)
+		}
+		content = []byte(markdownSummary(r, groups, runErr, format == "github"))
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if format == "github" {
+		// Job summaries are shared by all steps.
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(filename, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *Syncer) jsonSummary(r Result, runErr error) ([]byte, error) {
+	sum := summary{Result: r}
+	if s.Cfg.GroupBy != "" {
+		sum.Groups = r.groups(s.Cfg.GroupBy)
+	}
+	if runErr != nil {
+		sum.Error = runErr.Error()
+	}
+	b, err := json.MarshalIndent(sum, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// postSync runs the post-sync command with the shell in the root, with the
+// JSON summary of the sync on stdin.
+func (s *Syncer) postSync(r Result, runErr error) error {
+	b, err := s.jsonSummary(r, runErr)
+	if err != nil {
+		return err
+	}
+	cmd := shellCommand(s.Cfg.PostSyncCmd)
+	cmd.Dir, cmd.Stdin, cmd.Stdout, cmd.Stderr = s.Cfg.Root, bytes.NewReader(b), s.out, s.out
+	return cmd.Run()
+}
+
+// markdownSummary renders r as Markdown, with the repo lists split by
+// groups if set. With collapsible set, the repo lists are wrapped in
+// <details> elements.
+func markdownSummary(r Result, groups []resultGroup, runErr error, collapsible bool) string {
+	var b strings.Builder
+	b.WriteString("## gitjoin\n\n")
+	fmt.Fprintf(&b, "| Updated | Cloned | Removed | Skipped | Failed |\n|---|---|---|---|---|\n| %d | %d | %d | %d | %d |\n",
+		len(r.Updated), len(r.Cloned), len(r.Removed), len(r.Skipped), len(r.Failed))
+
+	if groups == nil {
+		writeMarkdownSections(&b, r, "###", collapsible)
+	}
+	for _, g := range groups {
+		fmt.Fprintf(&b, "\n### %s\n", g.Name)
+		writeMarkdownSections(&b, g.Result, "####", collapsible)
+	}
+
+	if runErr != nil {
+		fmt.Fprintf(&b, "\n### Error\n\n```\n%s\n```\n", runErr)
+	}
+	return b.String()
+}
+
+func writeMarkdownSections(b *strings.Builder, r Result, heading string, collapsible bool) {
+	for _, sec := range resultSections(r) {
+		if len(sec.repos) == 0 {
+			continue
+		}
+		title := fmt.Sprintf("%s: %d repos", sec.title, len(sec.repos))
+		if collapsible {
+			fmt.Fprintf(b, "\n<details>\n<summary>%s</summary>\n\n", title)
+		} else {
+			fmt.Fprintf(b, "\n%s %s\n\n", heading, title)
+		}
+		for _, repo := range sec.repos {
+			fmt.Fprintf(b, "- `%s`", repo.Path)
+			if repo.Detail != "" {
+				fmt.Fprintf(b, " (%s)", repo.Detail)
+			}
+			if repo.loc != "" {
+				fmt.Fprintf(b, " `%s`", repo.loc)
+			}
+			b.WriteString("\n")
+		}
+		if collapsible {
+			b.WriteString("\n</details>\n")
+		}
+	}
+}
+
+// printTotals prints the totals of the sync, first for people, then as a
+// TOTALS line of key=value pairs for scripts and CI logs.
+func (s *Syncer) printTotals(r Result, elapsed time.Duration) {
+	line := fmt.Sprintf("Synced %d repos in %s", r.Repos, elapsed.Round(time.Millisecond))
+	if r.Received > 0 {
+		line += ", received " + formatBytes(r.Received)
+	}
+	s.log("%s\n", line)
+	s.log("TOTALS repos=%d updated=%d cloned=%d removed=%d skipped=%d failed=%d received=%d seconds=%.3f\n",
+		r.Repos, len(r.Updated), len(r.Cloned), len(r.Removed), len(r.Skipped), len(r.Failed), r.Received, elapsed.Seconds())
+}
+
+// formatBytes formats n as e.g. 1.5 MiB.
+func formatBytes(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	f, unit := float64(n)/1024, 0
+	for f >= 1024 && unit < 4 {
+		f /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %ciB", f, "KMGTP"[unit])
+}
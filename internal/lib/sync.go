@@ -4,398 +4,1699 @@
 package lib
 
 import (
-	"bufio"
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/bep/helpers/parahelpers"
+	"github.com/bmatcuk/doublestar/v4"
 )
 
 type Syncer struct {
-	Cfg Config
-	out io.Writer
+	Cfg    Config
+	ws     workspaceConfig
+	out    io.Writer
+	stdout io.Writer
+	color  bool
+	retry  map[string]bool  // if set, only sync these repos
+	only   map[string]entry // if set, the repos to sync, without walking the root
+
+	planned map[string]string // set by Apply, the planned action by local path
+	cache   *metaCache
+	refs    *referenceStore // optional
+
+	api *hostAPI // set with Config.CheckArchived or Config.Since
+
+	manifestMu *sync.Mutex // guards edits of gitjoin.txt files during a sync
+
+	fsmonitor func() bool // whether git has a builtin fsmonitor on this platform
+	git       gitVersion  // of the git binary used
+
+	// ctx is cancelled when the sync is interrupted, killCtx when the
+	// git commands still running should be killed.
+	ctx, killCtx context.Context
 }
 
-func Sync(cfg Config) error {
+func newSyncer(cfg Config) (*Syncer, error) {
+	ws, err := loadWorkspaceConfig(cfg.Root)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateDisambiguate(cfg.Disambiguate); err != nil {
+		return nil, err
+	}
+	httpArgs, err := ws.httpArgs(cfg.Root)
+	if err != nil {
+		return nil, err
+	}
+	cfg.GitArgs = append(slices.Clone(cfg.GitArgs), httpArgs...)
+	if cfg, err = cfg.withCredentials(); err != nil {
+		return nil, err
+	}
+	version, err := probeGit(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxBandwidth > 0 && cfg.limiter == nil {
+		cfg.limiter = &limiter{rate: float64(cfg.MaxBandwidth)}
+	}
 	out := io.Writer(os.Stderr)
 	if cfg.Quiet {
 		out = io.Discard
 	}
-	s := &Syncer{Cfg: cfg, out: out}
-	result, err := s.run()
+	s := &Syncer{Cfg: cfg, ws: ws, out: out, stdout: os.Stdout, color: useColor(cfg.Color, out), cache: loadCache(cfg.Root), ctx: context.Background(), killCtx: context.Background(), manifestMu: new(sync.Mutex), git: version}
+	s.fsmonitor = sync.OnceValue(func() bool {
+		out, _ := s.repo("").run("version", "--build-options")
+		return strings.Contains(out, "feature: fsmonitor--daemon")
+	})
+	if cfg.CheckArchived || cfg.Since {
+		s.api = newHostAPI()
+	}
+	if ws.ReferenceStore != "" {
+		dir, err := expandPath(ws.ReferenceStore, cfg.Root)
+		if err != nil {
+			return nil, err
+		}
+		s.refs = &referenceStore{repo: Repo{Path: dir, gitBin: cfg.GitBin, gitArgs: cfg.GitArgs, env: cfg.gitEnv, interactive: cfg.InteractiveAuth}}
+	}
+	return s, nil
+}
+
+// repo returns the repo at localPath.
+func (s *Syncer) repo(localPath string) Repo {
+	return Repo{Path: filepath.Join(s.Cfg.Root, localPath), gitBin: s.Cfg.GitBin, gitArgs: s.Cfg.GitArgs, env: s.Cfg.gitEnv, cache: s.cache, interactive: s.Cfg.InteractiveAuth, noSwitch: s.git.less(gitVersion{2, 23}), ctx: s.killCtx}
+}
+
+func Sync(cfg Config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	s, err := newSyncer(cfg)
 	if err != nil {
 		return err
 	}
-	s.printResult(result)
+	_, err = s.sync()
+	return err
+}
+
+func (c Config) validate() error {
+	if c.OnlyClone && c.OnlyUpdate {
+		return errors.New("only one of -only-clone and -only-update can be set")
+	}
+	if err := validateGitignore(c.Gitignore); err != nil {
+		return err
+	}
+	if c.MaxDepth < 0 {
+		return errors.New("-max-depth can't be negative")
+	}
+	if c.CloneJobs < 0 || c.PullJobs < 0 {
+		return errors.New("-clone-jobs and -pull-jobs can't be negative")
+	}
+	if c.MaxStash < 0 {
+		return errors.New("-max-stash can't be negative")
+	}
+	if err := validateGroupBy(c.GroupBy); err != nil {
+		return err
+	}
+	if c.Offline && c.Force {
+		return errors.New("-force can't be used with -offline")
+	}
+	if c.ResetDiverged && !c.Force {
+		return errors.New("-reset-diverged requires -force")
+	}
+	if c.Offline && c.Repair {
+		return errors.New("-repair can't be used with -offline")
+	}
+	if c.Offline && c.CheckArchived {
+		return errors.New("-check-archived can't be used with -offline")
+	}
+	if c.CheckArchived && os.Getenv("GITHUB_TOKEN") == "" && os.Getenv("GH_TOKEN") == "" && os.Getenv("GITLAB_TOKEN") == "" {
+		return errors.New("-check-archived requires GITHUB_TOKEN, GH_TOKEN or GITLAB_TOKEN")
+	}
+	if c.Since && os.Getenv("GITHUB_TOKEN") == "" && os.Getenv("GH_TOKEN") == "" && os.Getenv("GITLAB_TOKEN") == "" {
+		return errors.New("-since requires GITHUB_TOKEN, GH_TOKEN or GITLAB_TOKEN")
+	}
+	if c.PullRoot && c.Offline {
+		return errors.New("-pull-root can't be used with -offline")
+	}
+	if c.Since {
+		// They turn off the cache -since relies on, see reuseState.
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"-no-cache", c.NoCache},
+			{"-force", c.Force},
+			{"-offline", c.Offline},
+			{"-prune-branches", c.PruneBranches},
+			{"-check-archived", c.CheckArchived},
+			{"-tags", c.Tags},
+			{"-verify-signatures", c.VerifySignatures},
+		} {
+			if f.set {
+				return fmt.Errorf("-since can't be used with %s", f.name)
+			}
+		}
+	}
+	switch c.SummaryFormat {
+	case "", "md", "json", "github":
+	default:
+		return fmt.Errorf("invalid summary format %q", c.SummaryFormat)
+	}
 	return nil
 }
 
+// sync runs a full sync and reports the result.
+func (s *Syncer) sync() (Result, error) {
+	start := time.Now()
+	result, err := s.syncRoot()
+	return s.report(result, start, err)
+}
+
+// syncRoot runs a full sync of the root and saves the state for the next
+// run, also when interrupted.
+func (s *Syncer) syncRoot() (Result, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Result{}, err
+	}
+	defer unlock()
+	if s.Cfg.MaxBandwidth > 0 {
+		unthrottle, err := s.throttle()
+		if err != nil {
+			return Result{}, err
+		}
+		defer unthrottle()
+	}
+	stop := s.trapSignals()
+	defer stop()
+	result, err := s.run()
+	if err != nil && !stoppedEarly(err) {
+		return result, err
+	}
+	st := state{Failed: result.Failed}
+	if s.retry != nil {
+		// The failures of the repos not synced still need a retry.
+		prev, err := loadState(s.Cfg.Root)
+		if err != nil {
+			return result, err
+		}
+		for _, f := range prev.Failed {
+			if !s.retry[f.Path] {
+				st.Failed = append(st.Failed, f)
+			}
+		}
+	}
+	if err := saveState(s.Cfg.Root, st); err != nil {
+		return result, fmt.Errorf("save state: %w", err)
+	}
+	if err := s.cache.save(s.Cfg.Root); err != nil {
+		return result, fmt.Errorf("save cache: %w", err)
+	}
+	if err := appendHistory(s.Cfg.Root, s.Cfg.Args, result); err != nil {
+		return result, fmt.Errorf("save history: %w", err)
+	}
+	return result, err
+}
+
+// report writes the summary file and prints the result of a sync started
+// at start that ended with err.
+func (s *Syncer) report(result Result, start time.Time, err error) (Result, error) {
+	if s.Cfg.Profile {
+		result.Duration = time.Since(start)
+	}
+	if s.Cfg.Ordered {
+		result.sortByManifest()
+	}
+	if s.Cfg.SummaryFile != "" || s.Cfg.SummaryFormat == "github" {
+		if serr := s.writeSummary(result, err); serr != nil && err == nil {
+			err = fmt.Errorf("write summary: %w", serr)
+		}
+	}
+	if s.Cfg.PostSyncCmd != "" {
+		if perr := s.postSync(result, err); perr != nil && err == nil {
+			err = fmt.Errorf("post-sync command: %w", perr)
+		}
+	}
+	if err != nil && !stoppedEarly(err) {
+		return result, err
+	}
+	if s.Cfg.ChangesOnly && err == nil && result.empty() {
+		return result, nil
+	}
+	s.printResult(result)
+	if s.Cfg.Profile {
+		s.printProfile(result)
+	}
+	if result.Repos > 0 || !result.empty() {
+		s.printTotals(result, time.Since(start))
+	}
+	if err != nil {
+		return result, err
+	}
+	if n := len(result.Failed); n > 0 {
+		return result, fmt.Errorf("%d repos failed", n)
+	}
+	return result, nil
+}
+
+// SyncRoots syncs each of roots as a separate workspace and prints a
+// combined summary with the repo paths prefixed by their root.
+func SyncRoots(cfg Config, roots []string) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	start := time.Now()
+	var (
+		combined Result
+		s        *Syncer
+	)
+	if cfg.MaxBandwidth > 0 {
+		cfg.limiter = &limiter{rate: float64(cfg.MaxBandwidth)}
+	}
+	for _, root := range roots {
+		c := cfg
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		c.Root = abs
+		if s, err = newSyncer(c); err != nil {
+			return fmt.Errorf("%s: %w", root, err)
+		}
+		r, err := s.syncRoot()
+		if stoppedEarly(err) {
+			combined.add(r, path.Clean(filepath.ToSlash(root)))
+			_, err := s.report(combined, start, err)
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", root, err)
+		}
+		combined.add(r, path.Clean(filepath.ToSlash(root)))
+	}
+	_, err := s.report(combined, start, nil)
+	return err
+}
+
+// empty reports whether nothing happened to any repo.
+func (r Result) empty() bool {
+	return len(r.Updated)+len(r.Cloned)+len(r.Removed)+len(r.Skipped)+len(r.Failed) == 0
+}
+
+// sortByManifest sorts the repos in r in the order they're listed in the
+// gitjoin.txt files.
+func (r Result) sortByManifest() {
+	order := manifestOrder(r.entries)
+	slices.SortFunc(r.Updated, func(a, b RepoResult) int { return order(a.Path, b.Path) })
+	slices.SortFunc(r.Cloned, func(a, b RepoResult) int { return order(a.Path, b.Path) })
+	slices.SortFunc(r.Skipped, func(a, b SkippedRepo) int { return order(a.Path, b.Path) })
+	slices.SortFunc(r.Failed, func(a, b FailedRepo) int { return order(a.Path, b.Path) })
+	slices.Sort(r.Removed)
+}
+
+// manifestOrder compares local paths by where their entries are in the
+// gitjoin.txt files. Paths without an entry come first.
+func manifestOrder(entries map[string]entry) func(a, b string) int {
+	return func(a, b string) int {
+		ea, eb := entries[a], entries[b]
+		return cmp.Or(cmp.Compare(ea.File, eb.File), cmp.Compare(ea.Line, eb.Line), cmp.Compare(a, b))
+	}
+}
+
+// add adds the repos in other to r, prefixing their paths with prefix.
+func (r *Result) add(other Result, prefix string) {
+	join := func(p string) string { return path.Join(prefix, p) }
+	for _, v := range other.Updated {
+		v.Path = join(v.Path)
+		r.Updated = append(r.Updated, v)
+	}
+	for _, v := range other.Cloned {
+		v.Path = join(v.Path)
+		r.Cloned = append(r.Cloned, v)
+	}
+	for _, v := range other.Removed {
+		r.Removed = append(r.Removed, join(v))
+	}
+	for _, v := range other.Skipped {
+		v.Path = join(v.Path)
+		if v.Location != "" {
+			v.Location = join(v.Location)
+		}
+		r.Skipped = append(r.Skipped, v)
+	}
+	for _, v := range other.Failed {
+		v.Path = join(v.Path)
+		if v.Location != "" {
+			v.Location = join(v.Location)
+		}
+		r.Failed = append(r.Failed, v)
+	}
+	r.Repos += other.Repos
+	r.Received += other.Received
+	for _, v := range other.Timings {
+		v.Path = join(v.Path)
+		r.Timings = append(r.Timings, v)
+	}
+	for p, e := range other.entries {
+		if r.entries == nil {
+			r.entries = make(map[string]entry)
+		}
+		e.File = join(e.File)
+		r.entries[join(p)] = e
+	}
+}
+
 func (s *Syncer) log(format string, a ...any) {
 	fmt.Fprintf(s.out, format, a...)
 }
 
-func (s *Syncer) printResult(r Result) {
-	if len(r.Updated) > 0 {
-		s.log("Updated: %d repos\n", len(r.Updated))
-		for _, repo := range r.Updated {
+func (s *Syncer) header(color, format string, a ...any) {
+	s.log("%s\n", s.colorize(color, fmt.Sprintf(format, a...)))
+}
+
+// section is a titled list of repos in a summary.
+type section struct {
+	color string
+	title string
+	repos []RepoResult
+}
+
+// printSections prints the non-empty sections with details aligned across all of them.
+func (s *Syncer) printSections(sections ...section) {
+	s.printIndented("", sections...)
+}
+
+// printIndented is printSections with every line indented by indent.
+func (s *Syncer) printIndented(indent string, sections ...section) {
+	width := 0
+	for _, sec := range sections {
+		for _, repo := range sec.repos {
+			width = max(width, len(repo.Path))
+		}
+	}
+	for _, sec := range sections {
+		if len(sec.repos) == 0 {
+			continue
+		}
+		s.log("%s", indent)
+		s.header(sec.color, "%s: %d repos", sec.title, len(sec.repos))
+		for _, repo := range sec.repos {
+			line := repo.Path
+			if repo.Detail != "" || repo.loc != "" {
+				line = fmt.Sprintf("%-*s", width, repo.Path)
+			}
 			if repo.Detail != "" {
-				s.log("  - %s (%s)\n", repo.Path, repo.Detail)
-			} else {
-				s.log("  - %s\n", repo.Path)
+				line += "  (" + repo.Detail + ")"
+			}
+			if repo.loc != "" {
+				line += "  " + repo.loc
+			}
+			s.log("%s  - %s\n", indent, line)
+		}
+	}
+}
+
+func (s *Syncer) printResult(r Result) {
+	if s.Cfg.GroupBy == "" {
+		s.printSections(resultSections(r)...)
+		return
+	}
+	for _, g := range r.groups(s.Cfg.GroupBy) {
+		s.log("%s\n", g.Name)
+		s.printIndented("  ", resultSections(g.Result)...)
+	}
+}
+
+func resultSections(r Result) []section {
+	var removed []RepoResult
+	for _, path := range r.Removed {
+		removed = append(removed, RepoResult{Path: path})
+	}
+
+	sections := []section{
+		{colorGreen, "Updated", r.Updated},
+		{colorGreen, "Cloned", r.Cloned},
+		{colorYellow, "Removed", removed},
+	}
+	for _, reason := range []string{reasonUncommitted, reasonNonDefault, reasonDetached, reasonUnverified, reasonDiverged, reasonDisabled, reasonFrozen, reasonArchived, reasonOffline, reasonInProgress, reasonManual} {
+		var skipped []RepoResult
+		for _, skip := range r.Skipped {
+			if skip.Reason == reason {
+				skipped = append(skipped, RepoResult{Path: skip.Path, Detail: skip.Detail, loc: skip.Location})
 			}
 		}
+		sections = append(sections, section{colorYellow, "Skipped (" + reason + ")", skipped})
 	}
+	var failed []RepoResult
+	for _, f := range r.Failed {
+		failed = append(failed, RepoResult{Path: f.Path, Detail: f.Stage + ": " + strings.Join(strings.Fields(f.Err), " "), loc: f.Location})
+	}
+	return append(sections, section{colorRed, "Failed", failed})
+}
 
-	if len(r.Cloned) > 0 {
-		s.log("Cloned: %d repos\n", len(r.Cloned))
-		for _, repo := range r.Cloned {
-			s.log("  - %s\n", repo.Path)
+func (s *Syncer) run() (Result, error) {
+	if s.only != nil {
+		return s.runOnly()
+	}
+	if err := os.RemoveAll(filepath.Join(s.Cfg.Root, trashDir)); err != nil {
+		return Result{}, err
+	}
+	c := s.newCollector()
+	if s.Cfg.PullRoot {
+		if err := s.pullRoot(c); err != nil {
+			return c.result, err
 		}
 	}
+	t, err := s.walk()
+	if err != nil {
+		return Result{}, err
+	}
+	expected, err := s.expectedRepos(t)
+	if err != nil {
+		return Result{}, err
+	}
+	if s.seesAll() {
+		s.cache.setIndex(expected)
+		s.cache.pruneStates(expected)
+	}
 
-	if len(r.Removed) > 0 {
-		s.log("Removed: %d repos\n", len(r.Removed))
-		for _, path := range r.Removed {
-			s.log("  - %s\n", path)
+	repos := expected
+	if s.retry != nil || s.planned != nil {
+		repos = make(map[string]entry)
+		for localPath, e := range expected {
+			if action := s.planned[localPath]; s.retry[localPath] || action == actionClone || action == actionPull {
+				repos[localPath] = e
+			}
 		}
 	}
 
-	var uncommitted, nonDefault []SkippedRepo
-	for _, skip := range r.Skipped {
-		if skip.Reason == "uncommitted changes" {
-			uncommitted = append(uncommitted, skip)
-		} else {
-			nonDefault = append(nonDefault, skip)
+	err = s.syncRepos(c, repos)
+	if s.ctx.Err() != nil {
+		err = errInterrupted
+	}
+	if stoppedEarly(err) {
+		// Leave the rest for the next sync.
+		c.result.entries = expected
+		return c.result, err
+	}
+	if err != nil {
+		return c.result, err
+	}
+	if s.seesAll() {
+		if err := s.cleanStaging(expected); err != nil {
+			return c.result, err
 		}
 	}
 
-	if len(uncommitted) > 0 {
-		s.log("Skipped (uncommitted changes): %d repos\n", len(uncommitted))
-		for _, skip := range uncommitted {
-			s.log("  - %s (%s)\n", skip.Path, skip.Detail)
+	managed := expected
+	if !s.seesAll() {
+		if managed, err = s.allRepos(t); err != nil {
+			return c.result, err
 		}
 	}
 
-	if len(nonDefault) > 0 {
-		s.log("Skipped (non-default branch): %d repos\n", len(nonDefault))
-		for _, skip := range nonDefault {
-			s.log("  - %s (%s)\n", skip.Path, skip.Detail)
+	// Repos outside of the filters, -manifest and -max-depth are left alone.
+	if !s.Cfg.OnlyClone && !s.Cfg.OnlyUpdate && s.retry == nil && s.seesAll() {
+		unmanaged, err := s.unmanaged(t, expected)
+		if err != nil {
+			return c.result, err
+		}
+		for _, repo := range unmanaged {
+			if s.planned != nil && s.planned[repo] != actionRemove {
+				continue
+			}
+			if s.Cfg.Offline {
+				c.OnSkip(SkippedRepo{Path: repo, Reason: reasonOffline, Detail: "not removed"})
+				continue
+			}
+			// Recorded in the history for undo-remove.
+			r := s.repo(repo)
+			url, _ := r.RemoteURL()
+			head, _ := r.Head()
+			if err := s.removeDir(repo); err != nil {
+				c.OnFail(FailedRepo{Path: repo, Stage: "remove", Err: err.Error()})
+				continue
+			}
+			c.OnRemove(repo)
+			c.result.removed = append(c.result.removed, removedRepo{Path: repo, URL: url, Head: head})
 		}
 	}
+
+	if err := s.updateManagedFiles(managed); err != nil {
+		return c.result, err
+	}
+
+	c.result.entries = managed
+	return c.result, nil
 }
 
-func (s *Syncer) run() (Result, error) {
-	var result Result
-	var mu sync.Mutex
-	var existing sync.Map
+// runOnly syncs s.only, leaving the rest of the root, last indexed by a
+// full sync, as is.
+func (s *Syncer) runOnly() (Result, error) {
+	c := s.newCollector()
+	err := s.syncRepos(c, s.only)
+	if s.ctx.Err() != nil {
+		err = errInterrupted
+	}
+	c.result.entries = s.only
+	if err != nil {
+		return c.result, err
+	}
+	managed := make(map[string]entry)
+	for localPath, repoPath := range s.cache.Index {
+		managed[localPath] = entry{Repo: repoPath}
+	}
+	maps.Copy(managed, s.only)
+	return c.result, s.updateManagedFiles(managed)
+}
 
-	expected, err := s.collectExpectedRepos()
+// pullRoot pulls the root repo, so the gitjoin.txt files in it are up to
+// date before they're read.
+func (s *Syncer) pullRoot(events Events) error {
+	repo := s.repo("")
+	if !repo.IsGitRepo() {
+		return errors.New("-pull-root requires the root to be a git repo")
+	}
+	if _, err := repo.fetch(); err != nil {
+		return fmt.Errorf("pull root: %w", err)
+	}
+	pulled, err := repo.Pull()
 	if err != nil {
-		return result, err
+		return fmt.Errorf("pull root: %w", err)
+	}
+	if pulled > 0 {
+		events.OnPull(RepoResult{Path: ".", Detail: "workspace root", Commits: pulled})
 	}
+	return nil
+}
 
-	numWorkers := max(4, runtime.NumCPU())
-	workers := parahelpers.New(numWorkers)
-	r, ctx := workers.Start(context.Background())
+// syncRepos processes the repos to clone and the repos to update in
+// separate queues, so slow clones don't hold up the updates.
+func (s *Syncer) syncRepos(c *collector, repos map[string]entry) error {
+	if s.Cfg.MaxBandwidth > 0 {
+		if ssh := s.sshRepos(repos); len(ssh) > 0 {
+			s.log("-max-bandwidth doesn't throttle SSH remotes, used by %d repos, e.g. %s\n", len(ssh), ssh[0])
+		}
+	}
+	// Cancelled with an unreachableError after Config.MaxFailures.
+	ctx, stop := context.WithCancelCause(s.ctx)
+	defer stop(nil)
+	process := func(localPath string) error {
+		if ctx.Err() != nil {
+			return nil
+		}
+		start := time.Now()
+		stats := &repoStats{}
+		err := s.processRepo(localPath, repos[localPath], stats, c)
+		if n := c.onProcessed(stats); s.Cfg.MaxFailures > 0 && n >= s.Cfg.MaxFailures {
+			stop(&unreachableError{n: n, last: stats.unreachable})
+		}
+		if s.Cfg.Profile {
+			c.onTiming(Timing{Path: localPath, Wall: time.Since(start), CPU: stats.cpu})
+		}
+		return err
+	}
 
-	for localPath, repoPath := range expected {
+	var clones, pulls []string
+	for localPath := range repos {
+		if _, err := os.Stat(filepath.Join(s.Cfg.Root, localPath)); os.IsNotExist(err) {
+			clones = append(clones, localPath)
+		} else {
+			pulls = append(pulls, localPath)
+		}
+	}
+	if s.Cfg.Ordered {
+		slices.SortFunc(clones, manifestOrder(repos))
+		slices.SortFunc(pulls, manifestOrder(repos))
+	}
+	var err error
+	switch {
+	case s.Cfg.Ordered && s.Cfg.CloneJobs == 1 && s.Cfg.PullJobs == 1:
+		err = s.forEachRepoJobs(slices.SortedFunc(maps.Keys(repos), manifestOrder(repos)), 1, process)
+	case s.Cfg.InteractiveAuth:
+		err = s.forEachRepo(append(pulls, clones...), process)
+	default:
+		cloneErr := make(chan error, 1)
+		go func() {
+			cloneErr <- s.forEachRepoJobs(clones, s.Cfg.CloneJobs, process)
+		}()
+		err = errors.Join(s.forEachRepoJobs(pulls, s.Cfg.PullJobs, process), <-cloneErr)
+	}
+	if ctx.Err() != nil && s.ctx.Err() == nil {
+		return context.Cause(ctx)
+	}
+	return err
+}
+
+// unreachableError is returned when a sync stops after n repos in a row
+// failed to reach their remote, the last for the reason last.
+type unreachableError struct {
+	n    int
+	last string
+}
+
+func (e *unreachableError) Error() string {
+	return fmt.Sprintf("stopped after %d repos in a row failed to reach their remote, check the network and credentials; the last: %s", e.n, strings.Join(strings.Fields(e.last), " "))
+}
+
+// stoppedEarly reports whether err means the sync stopped before all
+// repos were processed, but what was done should still be reported.
+func stoppedEarly(err error) bool {
+	var unreachable *unreachableError
+	return errors.Is(err, errInterrupted) || errors.As(err, &unreachable)
+}
+
+// forEachRepo calls fn for each of the given repos in parallel, or one at
+// a time if git may prompt for credentials.
+func (s *Syncer) forEachRepo(localPaths []string, fn func(localPath string) error) error {
+	return s.forEachRepoJobs(localPaths, 0, fn)
+}
+
+// forEachRepoJobs is forEachRepo with at most jobs repos processed at a
+// time (0 means the default).
+func (s *Syncer) forEachRepoJobs(localPaths []string, jobs int, fn func(localPath string) error) error {
+	n := max(4, runtime.NumCPU())
+	if jobs > 0 {
+		n = jobs
+	}
+	if s.Cfg.InteractiveAuth {
+		n = 1
+	}
+	workers := parahelpers.New(n)
+	r, ctx := workers.Start(s.ctx)
+	for _, localPath := range localPaths {
 		r.Run(func() error {
-			return s.processRepo(ctx, localPath, repoPath, &existing, &result, &mu)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fn(localPath)
 		})
 	}
+	return r.Wait()
+}
 
-	if err := r.Wait(); err != nil {
-		return result, err
+func (s *Syncer) processRepo(localPath string, e entry, stats *repoStats, events Events) error {
+	fullPath := filepath.Join(s.Cfg.Root, localPath)
+	fail := func(stage string, err error) error {
+		if isAuthError(err.Error()) {
+			err = errAuth
+		}
+		if errors.Is(err, errAuth) || isNetworkError(err.Error()) {
+			stats.unreachable = err.Error()
+		}
+		events.OnFail(FailedRepo{Path: localPath, Stage: stage, Err: err.Error(), Location: e.location()})
+		return nil
+	}
+	if e.sparsePaths() != nil && s.git.less(sparseGitVersion) {
+		return fail("sparse checkout", fmt.Errorf("needs git %s or later, this is %s", sparseGitVersion, s.git))
+	}
+
+	if e.has("off") {
+		events.OnSkip(SkippedRepo{Path: localPath, Reason: reasonDisabled, Location: e.location()})
+		return nil
 	}
 
-	allRepos, err := s.findAllGitRepos()
+	repo := s.repo(localPath)
+	repo.stats = stats
+	if e.has("readonly") {
+		// No credentials for code that's never pushed to.
+		repo.gitArgs = append(slices.Clone(repo.gitArgs), "-c", "credential.helper=")
+	}
+	fp, err := s.ws.fetchProfile(localPath, e.Repo)
 	if err != nil {
-		return result, err
+		return fail("config", err)
+	}
+	if fp.NegotiationAlgorithm != "" {
+		repo.gitArgs = append(slices.Clone(repo.gitArgs), "-c", "fetch.negotiationAlgorithm="+fp.NegotiationAlgorithm)
+	}
+	for _, tip := range fp.NegotiationTips {
+		repo.fetchArgs = append(repo.fetchArgs, "--negotiation-tip="+tip)
+	}
+	if s.Cfg.Tags || e.has("tags") {
+		// Left to FetchTags, which reports the new ones.
+		repo.fetchArgs = append(repo.fetchArgs, "--no-tags")
+	}
+
+	clone := func(detail string) error {
+		url := s.ws.rewriteURL(repoPathToURL(e.Repo, e.protocol()))
+		if isInsecureURL(url) && !s.Cfg.AllowInsecure {
+			return fail("clone", fmt.Errorf("insecure clone URL %s, use -allow-insecure to allow", url))
+		}
+		if s.refs != nil {
+			if err := s.refs.add(e.Repo, url); err != nil {
+				return fail("reference store", err)
+			}
+		}
+		notes, err := s.cloneStaged(repo, localPath, url, e)
+		if err != nil {
+			return fail("clone", err)
+		}
+		notes = append([]string{detail}, notes...)
+		if sha := e.Annotations["freeze"]; sha != "" {
+			if _, err := repo.run("checkout", "--detach", sha); err != nil {
+				return fail("freeze", err)
+			}
+			notes = append(notes, "frozen at "+sha[:min(len(sha), 7)])
+		} else if e.has("latest-tag") {
+			tag, err := repo.LatestTag()
+			if err != nil {
+				return fail("latest tag", err)
+			}
+			if tag != "" {
+				if _, err := repo.CheckoutTag(tag); err != nil {
+					return fail("latest tag", err)
+				}
+				notes = append(notes, "at "+tag)
+			}
+		}
+		detail = strings.Join(slices.DeleteFunc(notes, func(n string) bool { return n == "" }), ", ")
+		if sparse := e.sparsePaths(); sparse != nil {
+			if err := repo.SetSparseCheckout(sparse); err != nil {
+				return fail("sparse checkout", err)
+			}
+		}
+		if _, err := s.applyGitConfig(repo, localPath, e); err != nil {
+			return fail("config", err)
+		}
+		events.OnClone(RepoResult{Path: localPath, Detail: detail})
+		return nil
 	}
-	for _, repo := range allRepos {
-		if _, found := existing.Load(repo); !found {
-			fullPath := filepath.Join(s.Cfg.Root, repo)
-			if err := os.RemoveAll(fullPath); err != nil {
-				return result, fmt.Errorf("remove %s: %w", repo, err)
+
+	// repair re-clones the leftovers of an interrupted clone, or fails with err.
+	repair := func(stage string, err error) error {
+		reason := repo.leftover()
+		if reason == "" {
+			return fail(stage, err)
+		}
+		if !s.Cfg.Repair {
+			return fail(stage, fmt.Errorf("%s, likely an interrupted clone; use -repair to re-clone", reason))
+		}
+		if err := s.removeDir(localPath); err != nil {
+			return fail("repair", err)
+		}
+		return clone("repaired " + reason)
+	}
+
+	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+		if s.Cfg.OnlyUpdate {
+			return nil
+		}
+		if s.Cfg.Offline {
+			events.OnSkip(SkippedRepo{Path: localPath, Reason: reasonOffline, Detail: "not cloned", Location: e.location()})
+			return nil
+		}
+		return clone("")
+	}
+
+	if s.Cfg.OnlyClone {
+		return nil
+	}
+
+	if !repo.IsGitRepo() {
+		return repair("open", errors.New("not a git repo"))
+	}
+
+	// Skip the rest if nothing changed since the last sync, reporting
+	// what it reported.
+	fetched := false
+	if s.reuseState(e) {
+		// With -no-cache, the state is still recorded for the next sync.
+		st, found := s.cache.state(localPath)
+		found = found && !s.Cfg.NoCache
+		fetchedAt := time.Now()
+		fetch := !s.Cfg.Since || !found || !s.api.pushedBefore(e, st.Fetched)
+		if !fetch {
+			fetchedAt = st.Fetched
+		}
+		fp, err := s.fingerprint(repo, e, fetch)
+		if err != nil {
+			return fail("fetch", err)
+		}
+		// No fingerprint if the fetch was redirected, which is handled
+		// below.
+		fetched = fetch && fp != ""
+		if found && fp != "" && st.Fingerprint == fp {
+			if st.Skip != nil {
+				events.OnSkip(*st.Skip)
+			}
+			return nil
+		}
+		o := &outcome{Events: events}
+		events = o
+		defer func() {
+			if o.failed {
+				s.cache.setState(localPath, repoState{})
+			} else if fp, err := s.fingerprint(repo, e, false); err == nil {
+				s.cache.setState(localPath, repoState{Fingerprint: fp, Skip: o.skip, Fetched: fetchedAt})
+			}
+		}()
+	}
+
+	defaultBranch, err := repo.DefaultBranch()
+	if err != nil {
+		return repair("get default branch", err)
+	}
+
+	st, err := repo.Status()
+	if err != nil {
+		return fail("status", err)
+	}
+	currentBranch := st.Branch
+
+	var details []string
+	skip := func(reason string, detail ...string) error {
+		events.OnSkip(SkippedRepo{
+			Path:     localPath,
+			Reason:   reason,
+			Detail:   strings.Join(append(details, detail...), ", "),
+			Location: e.location(),
+		})
+		return nil
+	}
+
+	if op := repo.Operation(); op != "" {
+		return skip(reasonInProgress, op+", finish or abort it")
+	}
+
+	newDefaultBranch := defaultBranch
+	if !s.Cfg.Offline {
+		if !fetched {
+			redirect, err := repo.fetch()
+			if err != nil {
+				return fail("fetch", err)
+			}
+			if redirect != "" {
+				note, err := s.moved(repo, e, redirect)
+				if err != nil {
+					return fail("fetch", err)
+				}
+				if note != "" {
+					details = append(details, note)
+				}
 			}
-			result.Removed = append(result.Removed, repo)
+		}
+		if newDefaultBranch, err = repo.RefreshDefaultBranch(); err != nil {
+			return fail("refresh default branch", err)
 		}
 	}
-
-	if err := s.updateGitignore(expected); err != nil {
-		return result, fmt.Errorf("update .gitignore: %w", err)
+	if newDefaultBranch != defaultBranch {
+		details = append(details, "default branch changed to "+newDefaultBranch)
+		if s.Cfg.RenameBranches && currentBranch == defaultBranch && !repo.HasBranch(newDefaultBranch) {
+			if err := repo.RenameBranch(defaultBranch, newDefaultBranch); err != nil {
+				return fail("rename branch", err)
+			}
+			details = append(details, "renamed "+defaultBranch)
+			currentBranch = newDefaultBranch
+		}
+		defaultBranch = newDefaultBranch
 	}
 
-	return result, nil
-}
-
-func (s *Syncer) processRepo(ctx context.Context, localPath, repoPath string, existing *sync.Map, result *Result, mu *sync.Mutex) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
+	if s.Cfg.PruneBranches {
+		pruned, err := repo.PruneBranches("origin/"+defaultBranch, currentBranch)
+		if err != nil {
+			return fail("prune branches", err)
+		}
+		if len(pruned) > 0 {
+			details = append(details, "pruned "+strings.Join(pruned, " "))
+		}
 	}
 
-	fullPath := filepath.Join(s.Cfg.Root, localPath)
-	existing.Store(localPath, true)
-
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		url := repoPathToURL(repoPath)
-		if err := clone(url, fullPath, s.out); err != nil {
-			return fmt.Errorf("clone %s: %w", localPath, err)
+	if sparse := e.sparsePaths(); sparse != nil {
+		current, err := repo.SparseCheckout()
+		if err != nil {
+			return fail("sparse checkout", err)
+		}
+		if !slices.Equal(current, sparse) {
+			if err := repo.SetSparseCheckout(sparse); err != nil {
+				return fail("sparse checkout", err)
+			}
+			details = append(details, "sparse checkout updated")
 		}
-		mu.Lock()
-		result.Cloned = append(result.Cloned, RepoResult{Path: localPath})
-		mu.Unlock()
-		return nil
 	}
 
-	repo := Repo{Path: fullPath}
-
-	if !repo.IsGitRepo() {
-		return fmt.Errorf("%s: not a git repo", localPath)
+	if changed, err := s.applyGitConfig(repo, localPath, e); err != nil {
+		return fail("config", err)
+	} else if changed {
+		details = append(details, "git config updated")
 	}
 
-	defaultBranch, err := repo.DefaultBranch()
-	if err != nil {
-		return fmt.Errorf("%s: get default branch: %w", localPath, err)
+	detached := currentBranch == ""
+	head := st.Head[:min(len(st.Head), 7)]
+
+	if sha := e.Annotations["freeze"]; sha != "" {
+		if strings.HasPrefix(st.Head, sha) {
+			return skip(reasonFrozen, "at "+head)
+		}
+		return skip(reasonFrozen, "at "+sha[:min(len(sha), 7)], "HEAD moved to "+head)
 	}
 
-	currentBranch, err := repo.CurrentBranch()
-	if err != nil {
-		return fmt.Errorf("%s: get current branch: %w", localPath, err)
+	if s.Cfg.CheckArchived {
+		if r, err := s.api.lookup(e.Repo); err != nil {
+			details = append(details, "archive check failed: "+err.Error())
+		} else if r.Archived {
+			return skip(reasonArchived, "archived on "+r.Host+", consider removing it")
+		}
 	}
+	dirty := st.dirty()
 
-	dirty, err := repo.HasUncommittedChanges()
-	if err != nil {
-		return fmt.Errorf("%s: check uncommitted changes: %w", localPath, err)
+	// A repo at a release tag is moved to the newest one. One that has
+	// been moved off it by the user is handled like any other repo below.
+	if e.has("latest-tag") && !dirty && !s.Cfg.Offline {
+		if _, err := repo.FetchTags(); err != nil {
+			return fail("fetch tags", err)
+		}
+		tag, err := repo.LatestTag()
+		if err != nil {
+			return fail("latest tag", err)
+		}
+		atTag := false
+		if detached {
+			out, _ := repo.run("tag", "--points-at", "HEAD")
+			atTag = strings.TrimSpace(out) != ""
+		}
+		if tag != "" && (atTag || currentBranch == defaultBranch) {
+			moved, err := repo.CheckoutTag(tag)
+			if err != nil {
+				return fail("latest tag", err)
+			}
+			if moved {
+				details = append(details, "checked out "+tag)
+			}
+			if len(details) > 0 {
+				events.OnPull(RepoResult{Path: localPath, Detail: strings.Join(details, ", ")})
+			}
+			return nil
+		}
 	}
 
 	if !s.Cfg.Force {
 		if dirty {
-			mu.Lock()
-			result.Skipped = append(result.Skipped, SkippedRepo{
-				Path:   localPath,
-				Reason: "uncommitted changes",
-				Detail: repo.ChangesSummary(),
-			})
-			mu.Unlock()
-			return nil
+			return skip(reasonUncommitted, st.summary())
+		}
+		if detached {
+			return skip(reasonDetached, "at "+head)
 		}
 		if currentBranch != defaultBranch {
-			mu.Lock()
-			result.Skipped = append(result.Skipped, SkippedRepo{
-				Path:   localPath,
-				Reason: "non-default branch",
-				Detail: "on " + currentBranch,
-			})
-			mu.Unlock()
-			return nil
+			return skip(reasonNonDefault, "on "+currentBranch)
+		}
+		if s.Cfg.Offline {
+			return skip(reasonOffline, "not pulled")
+		}
+		pulled, commits, err := s.pull(repo, e)
+		var (
+			unverified *unverifiedError
+			diverged   *divergedError
+		)
+		if errors.As(err, &unverified) {
+			return skip(reasonUnverified, unverified.Error())
+		}
+		if errors.As(err, &diverged) {
+			return skip(reasonDiverged, diverged.Error())
 		}
-		changed, err := repo.Pull()
 		if err != nil {
-			return fmt.Errorf("%s: pull: %w", localPath, err)
+			return fail("pull", err)
 		}
-		if changed {
-			mu.Lock()
-			result.Updated = append(result.Updated, RepoResult{Path: localPath, Detail: "pulled"})
-			mu.Unlock()
+		details = append(details, pulled...)
+		if len(details) > 0 {
+			events.OnPull(RepoResult{Path: localPath, Detail: strings.Join(details, ", "), Commits: commits})
 		}
 	} else {
-		var details []string
+		// Stashing a large change set is too easy to get wrong, so leave
+		// it to the user.
+		if s.Cfg.MaxStash > 0 && len(st.Changes) > s.Cfg.MaxStash {
+			return skip(reasonManual, fmt.Sprintf("%d changed files, more than -max-stash %d", len(st.Changes), s.Cfg.MaxStash))
+		}
+		if detached && !repo.IsOnBranch("HEAD") {
+			return skip(reasonDetached, "at "+head, "commits not on any branch")
+		}
 		stashed := false
 		if dirty {
 			if err := repo.Stash(); err != nil {
-				return fmt.Errorf("%s: stash: %w", localPath, err)
+				return fail("stash", err)
 			}
 			stashed = true
 			details = append(details, "stashed")
 		}
 		if currentBranch != defaultBranch {
 			if err := repo.SwitchBranch(defaultBranch); err != nil {
-				return fmt.Errorf("%s: switch branch: %w", localPath, err)
+				return fail("switch branch", err)
+			}
+			if detached {
+				details = append(details, "switched to "+defaultBranch+" from "+head)
+			} else {
+				details = append(details, "switched to "+defaultBranch)
 			}
-			details = append(details, "switched to "+defaultBranch)
-		}
-		changed, err := repo.Pull()
-		if err != nil {
-			return fmt.Errorf("%s: pull: %w", localPath, err)
 		}
-		if changed {
-			details = append(details, "pulled")
+		pulled, commits, err := s.pull(repo, e)
+		var (
+			unverified *unverifiedError
+			diverged   *divergedError
+		)
+		if err != nil && !errors.As(err, &unverified) && !errors.As(err, &diverged) {
+			return fail("pull", err)
 		}
+		details = append(details, pulled...)
 		if stashed {
 			if err := repo.Unstash(); err != nil {
-				return fmt.Errorf("%s: unstash: %w", localPath, err)
+				return fail("unstash", err)
 			}
 			details = append(details, "unstashed")
 		}
+		if unverified != nil {
+			return skip(reasonUnverified, unverified.Error())
+		}
+		if diverged != nil {
+			return skip(reasonDiverged, diverged.Error(), "use -reset-diverged to reset")
+		}
 		if len(details) > 0 {
-			mu.Lock()
-			result.Updated = append(result.Updated, RepoResult{Path: localPath, Detail: strings.Join(details, ", ")})
-			mu.Unlock()
+			events.OnPull(RepoResult{Path: localPath, Detail: strings.Join(details, ", "), Commits: commits})
 		}
 	}
 	return nil
 }
 
-func (s *Syncer) collectExpectedRepos() (map[string]string, error) {
-	expected := make(map[string]string)
+// applyGitConfig sets the git config from the workspace config, the
+// identity and the config annotation in repo, and reports whether
+// anything changed.
+func (s *Syncer) applyGitConfig(repo Repo, localPath string, e entry) (bool, error) {
+	config := make(map[string]string)
+	for _, pattern := range slices.Sorted(maps.Keys(s.ws.Config)) {
+		matched, err := matchGlobs([]string{pattern}, localPath, e.Repo)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			maps.Copy(config, s.ws.Config[pattern])
+		}
+	}
+	identity, err := s.ws.identityConfig(localPath, e.Repo)
+	if err != nil {
+		return false, err
+	}
+	maps.Copy(config, identity)
+	annotated, err := e.gitConfig()
+	if err != nil {
+		return false, err
+	}
+	maps.Copy(config, annotated)
+
+	// Settings made by the user, also in their global config, are kept.
+	if s.Cfg.FSMonitor || e.has("fsmonitor") {
+		keys := []string{"core.untrackedCache"}
+		if s.fsmonitor() {
+			keys = append(keys, "core.fsmonitor")
+		}
+		for _, key := range keys {
+			if _, found := config[key]; found {
+				continue
+			}
+			if current, _ := repo.run("config", "--get", key); current == "" {
+				config[key] = "true"
+			}
+		}
+	}
 
-	err := filepath.WalkDir(s.Cfg.Root, func(path string, d os.DirEntry, err error) error {
+	var changed bool
+	for _, key := range slices.Sorted(maps.Keys(config)) {
+		c, err := repo.SetConfig(key, config[key])
 		if err != nil {
-			return err
+			return false, err
 		}
-		if d.IsDir() && d.Name() == ".git" {
-			return filepath.SkipDir
+		changed = changed || c
+	}
+	return changed, nil
+}
+
+type unverifiedError struct {
+	rev string
+}
+
+func (e *unverifiedError) Error() string {
+	return "signature verification failed, rolled back to " + e.rev
+}
+
+// pull pulls the repo and returns details about what happened and the
+// number of commits pulled.
+// If signature verification is enabled, the new HEAD must be signed by an
+// allowed signer, or the pull is rolled back.
+func (s *Syncer) pull(repo Repo, e entry) ([]string, int, error) {
+	var details []string
+	if s.Cfg.Tags || e.has("tags") {
+		newTags, err := repo.FetchTags()
+		if err != nil {
+			return nil, 0, err
 		}
-		if d.Name() != "gitjoin.txt" {
-			return nil
+		if len(newTags) > 0 {
+			details = append(details, "new tags "+strings.Join(newTags, " "))
 		}
+	}
 
-		dir := filepath.Dir(path)
-		relDir, err := filepath.Rel(s.Cfg.Root, dir)
+	// With -reset-diverged, a diverged branch is reset to its upstream.
+	pull := func() (int, error) {
+		pulled, err := repo.Pull()
+		var diverged *divergedError
+		if !errors.As(err, &diverged) || !s.Cfg.ResetDiverged {
+			return pulled, err
+		}
+		head, err := repo.Head()
 		if err != nil {
-			return err
+			return 0, err
+		}
+		if err := repo.ResetHard("@{upstream}"); err != nil {
+			return 0, err
 		}
+		details = append(details, fmt.Sprintf("reset from %s, %s", head[:min(len(head), 7)], diverged))
+		return diverged.behind, nil
+	}
+
+	if !s.Cfg.VerifySignatures && !e.has("verify-signatures") {
+		pulled, err := pull()
+		if pulled > 0 {
+			details = append([]string{"pulled"}, details...)
+		}
+		return details, pulled, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, 0, err
+	}
+	pulled, err := pull()
+	if err != nil || pulled == 0 {
+		return details, 0, err
+	}
+	allowedSigners := s.Cfg.AllowedSigners
+	if allowedSigners != "" && !filepath.IsAbs(allowedSigners) {
+		allowedSigners = filepath.Join(s.Cfg.Root, allowedSigners)
+	}
+	if err := repo.VerifyCommit("HEAD", allowedSigners); err != nil {
+		if err := repo.ResetHard(head); err != nil {
+			return nil, 0, err
+		}
+		return details, 0, &unverifiedError{rev: head[:min(len(head), 7)]}
+	}
+	return append([]string{"pulled"}, details...), pulled, nil
+}
 
-		repos, err := parseGitjoinFile(path)
+// cloneStaged clones url into a staging directory and moves it into place
+// at repo. An interrupted clone left in the staging directory is resumed
+// if possible, else started over; the returned notes say which, and
+// whether the repo has moved.
+func (s *Syncer) cloneStaged(repo Repo, localPath, url string, e entry) ([]string, error) {
+	staged := repo
+	staged.Path = s.stagingPath(localPath)
+	var (
+		note, redirect string
+		resumed        bool
+	)
+	if _, err := os.Stat(staged.Path); err == nil {
+		var args []string
+		if depth := e.Annotations["depth"]; depth != "" {
+			args = append(args, "--depth="+depth)
+		}
+		if staged.IsGitRepo() && staged.resumeClone(args) == nil {
+			note, resumed = "resumed interrupted clone", true
+		} else {
+			note = "restarted interrupted clone"
+			if err := os.RemoveAll(staged.Path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !resumed {
+		if err := os.MkdirAll(filepath.Dir(staged.Path), 0o755); err != nil {
+			return nil, err
+		}
+		var err error
+		if redirect, err = staged.clone(url, s.cloneArgs(e), s.out); err != nil {
+			// Keep what can be resumed.
+			if !staged.IsGitRepo() {
+				os.RemoveAll(staged.Path)
+			}
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(repo.Path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(staged.Path, repo.Path); err != nil {
+		return nil, err
+	}
+	notes := []string{note}
+	if redirect != "" {
+		moved, err := s.moved(repo, e, redirect)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		notes = append(notes, moved)
+	}
+	return notes, nil
+}
 
-		for _, repo := range repos {
-			repoName := filepath.Base(repo)
-			var localPath string
-			if relDir == "." {
-				localPath = repoName
-			} else {
-				localPath = filepath.Join(relDir, repoName)
+func (s *Syncer) cloneArgs(e entry) []string {
+	var args []string
+	filter := s.Cfg.Filter
+	if v, found := e.Annotations["filter"]; found {
+		filter = v
+	}
+	if filter != "" {
+		args = append(args, "--filter="+filter)
+	}
+	if e.sparsePaths() != nil {
+		args = append(args, "--sparse")
+	}
+	if s.Cfg.SingleBranch || e.has("single-branch") {
+		args = append(args, "--single-branch")
+	}
+	if depth := e.Annotations["depth"]; depth != "" {
+		args = append(args, "--depth="+depth)
+	}
+	if s.refs != nil {
+		args = append(args, "--reference-if-able="+s.refs.repo.Path)
+	}
+	return args
+}
+
+func (s *Syncer) collectExpectedRepos() (map[string]entry, error) {
+	t, err := s.walk()
+	if err != nil {
+		return nil, err
+	}
+	return s.expectedRepos(t)
+}
+
+// expectedRepos returns the repos listed in the gitjoin.txt files in t, or
+// in Config.Manifests if set, that match the filters.
+func (s *Syncer) expectedRepos(t tree) (map[string]entry, error) {
+	if err := s.checkRoot(); err != nil {
+		return nil, err
+	}
+	manifests, err := s.manifests(t)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[string]entry)
+	for _, manifest := range manifests {
+		if err := s.verifyManifest(manifest); err != nil {
+			return nil, err
+		}
+		entries, _, err := parseGitjoinFile(s.Cfg.Root, manifest)
+		if err != nil {
+			return nil, err
+		}
+
+		paths := localPaths(path.Dir(manifest), entries, s.Cfg.Disambiguate)
+		for i, e := range entries {
+			localPath := paths[i]
+
+			matched, err := s.matchPaths(localPath, e.Repo)
+			if err != nil {
+				return nil, err
+			}
+			if !matched || !s.matchHostOwner(e.Repo) {
+				continue
+			}
+			if matched, err = s.matchKind(localPath); err != nil {
+				return nil, err
+			} else if !matched {
+				continue
 			}
 
-			if s.Cfg.Paths != "" {
-				matched, err := filepath.Match(s.Cfg.Paths, localPath)
-				if err != nil {
-					return err
-				}
-				if !matched {
-					continue
+			if prev, found := expected[localPath]; found {
+				err := fmt.Errorf("%s (%s) and %s (%s) both resolve to %s", prev.Repo, prev.location(), e.Repo, e.location(), localPath)
+				if prev.Repo != e.Repo && s.Cfg.Disambiguate == "" {
+					err = fmt.Errorf("%w; use -disambiguate owner or owner-dir", err)
 				}
+				return nil, err
 			}
+			expected[localPath] = e
+		}
+	}
 
-			expected[localPath] = repo
+	// A manifest inside a managed repo would have gitjoin clone repos
+	// into another repo's working tree.
+	for localPath, e := range expected {
+		for dir := path.Dir(localPath); dir != "."; dir = path.Dir(dir) {
+			if parent, found := expected[dir]; found {
+				return nil, fmt.Errorf("%s (%s) is nested inside managed repo %s (%s)", localPath, e.location(), dir, parent.location())
+			}
 		}
-		return nil
-	})
+	}
 
-	return expected, err
+	return expected, nil
 }
 
-func (s *Syncer) findAllGitRepos() ([]string, error) {
+// unmanaged returns the repos in t that aren't in expected and don't
+// match a !keep pattern, i.e. the ones to remove. Unless
+// Config.RemoveAnywhere is set, only repos in a directory with a
+// gitjoin.txt or with repos listed in one are included.
+func (s *Syncer) unmanaged(t tree, expected map[string]entry) ([]string, error) {
+	manifests, err := s.manifests(t)
+	if err != nil {
+		return nil, err
+	}
+	dirs := make(map[string]bool)
+	for _, manifest := range manifests {
+		dirs[path.Dir(manifest)] = true
+	}
+	for localPath := range expected {
+		dirs[path.Dir(localPath)] = true
+	}
 	var repos []string
-	err := filepath.WalkDir(s.Cfg.Root, func(path string, d os.DirEntry, err error) error {
+	for _, repo := range t.repos {
+		if _, found := expected[repo]; !found && (s.Cfg.RemoveAnywhere || dirs[path.Dir(repo)]) {
+			repos = append(repos, repo)
+		}
+	}
+	if len(repos) == 0 {
+		return nil, nil
+	}
+	var keep []string
+	for _, manifest := range manifests {
+		_, patterns, err := parseGitjoinFile(s.Cfg.Root, manifest)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if d.IsDir() && d.Name() == ".git" {
-			rel, err := filepath.Rel(s.Cfg.Root, filepath.Dir(path))
-			if err != nil {
-				return err
-			}
-			if rel != "." {
-				repos = append(repos, rel)
-			}
-			return filepath.SkipDir
+		for _, pattern := range patterns {
+			keep = append(keep, path.Join(path.Dir(manifest), pattern))
 		}
-		return nil
-	})
-	return repos, err
+	}
+	var unmanaged []string
+	for _, repo := range repos {
+		kept, err := matchGlobs(keep, repo, "")
+		if err != nil {
+			return nil, err
+		}
+		if !kept {
+			unmanaged = append(unmanaged, repo)
+		}
+	}
+	return unmanaged, nil
 }
 
-func parseGitjoinFile(path string) ([]string, error) {
-	f, err := os.Open(path)
+// collectAllRepos is collectExpectedRepos without the filters, -manifest
+// and -max-depth.
+func (s *Syncer) collectAllRepos() (map[string]entry, error) {
+	t, err := s.walk()
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	return s.allRepos(t)
+}
 
-	var repos []string
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+// allRepos is expectedRepos without the filters, -manifest and
+// -max-depth. t is walked again if it was limited by -max-depth.
+func (s *Syncer) allRepos(t tree) (map[string]entry, error) {
+	all := *s
+	all.Cfg.Paths, all.Cfg.Hosts, all.Cfg.Owners, all.Cfg.Langs, all.Cfg.Modules = nil, nil, nil, nil, nil
+	all.Cfg.Manifests = nil
+	if all.Cfg.MaxDepth > 0 {
+		all.Cfg.MaxDepth = 0
+		var err error
+		if t, err = all.walk(); err != nil {
+			return nil, err
+		}
+	}
+	return all.expectedRepos(t)
+}
+
+// filtered reports whether any of the -paths, -host, -owner, -lang and
+// -module filters is set.
+func (s *Syncer) filtered() bool {
+	return len(s.Cfg.Paths) > 0 || len(s.Cfg.Hosts) > 0 || len(s.Cfg.Owners) > 0 || len(s.Cfg.Langs) > 0 || len(s.Cfg.Modules) > 0
+}
+
+// seesAll reports whether all managed repos are processed, i.e. neither
+// the filters, -manifest nor -max-depth are set.
+func (s *Syncer) seesAll() bool {
+	return !s.filtered() && len(s.Cfg.Manifests) == 0 && s.Cfg.MaxDepth == 0
+}
+
+// matchHostOwner reports whether repoPath, e.g. github.com/bep/hugo,
+// matches the -host and -owner filters.
+func (s *Syncer) matchHostOwner(repoPath string) bool {
+	host, rest, _ := strings.Cut(repoPath, "/")
+	owner, _, _ := strings.Cut(rest, "/")
+	if len(s.Cfg.Hosts) > 0 && !containsFold(s.Cfg.Hosts, host) {
+		return false
+	}
+	return len(s.Cfg.Owners) == 0 || containsFold(s.Cfg.Owners, owner)
+}
+
+// containsFold reports whether list contains v, ignoring case.
+func containsFold(list []string, v string) bool {
+	return slices.ContainsFunc(list, func(s string) bool { return strings.EqualFold(s, v) })
+}
+
+// checkRoot fails if the root is inside a repo managed by the gitjoin.txt
+// in the repo's parent directory, i.e. gitjoin is run from inside a
+// managed repo rather than from the workspace root.
+func (s *Syncer) checkRoot() error {
+	dir := s.Cfg.Root
+	for !(Repo{Path: dir}).IsGitRepo() {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+	parent := filepath.Dir(dir)
+	if _, err := os.Stat(filepath.Join(parent, "gitjoin.txt")); err != nil {
+		return nil
+	}
+	entries, _, err := parseGitjoinFile(parent, "gitjoin.txt")
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if path.Base(e.Repo) == filepath.Base(dir) {
+			return fmt.Errorf("%s is inside %s, which is managed by %s:%d; run gitjoin from the workspace root", s.Cfg.Root, dir, filepath.Join(parent, "gitjoin.txt"), e.Line)
+		}
+	}
+	return nil
+}
+
+// matchPaths reports whether localPath or repoPath, e.g. github.com/bep/hugo,
+// matches any of the -paths patterns.
+func (s *Syncer) matchPaths(localPath, repoPath string) (bool, error) {
+	if len(s.Cfg.Paths) == 0 {
+		return true, nil
+	}
+	return matchGlobs(s.Cfg.Paths, localPath, repoPath)
+}
+
+// matchGlobs reports whether any of the doublestar patterns matches
+// localPath or repoPath. Empty paths are ignored.
+func matchGlobs(patterns []string, localPath, repoPath string) (bool, error) {
+	for _, pattern := range patterns {
+		for _, name := range []string{localPath, repoPath} {
+			if name == "" {
+				continue
+			}
+			matched, err := doublestar.Match(pattern, name)
+			if err != nil || matched {
+				return matched, err
+			}
 		}
-		repos = append(repos, line)
 	}
-	return repos, scanner.Err()
+	return false, nil
 }
 
-func repoPathToURL(repoPath string) string {
+// repoPathToURL converts e.g. github.com/bep/hugo to a clone URL.
+// protocol is https, ssh, http, file or empty for the default. With
+// file, repoPath is an absolute path to the bare repo without .git.
+func repoPathToURL(repoPath, protocol string) string {
+	if protocol == "file" {
+		return "file:///" + strings.TrimPrefix(repoPath, "/") + ".git"
+	}
 	parts := strings.SplitN(repoPath, "/", 2)
 	if len(parts) != 2 {
 		return ""
 	}
-	if os.Getenv("GITHUB_ACTIONS") != "" {
-		return fmt.Sprintf("https://%s/%s.git", parts[0], parts[1])
+	if protocol == "" && os.Getenv("GITHUB_ACTIONS") != "" {
+		protocol = "https"
+	}
+	if protocol == "https" || protocol == "http" {
+		return fmt.Sprintf("%s://%s/%s.git", protocol, parts[0], parts[1])
 	}
 	return fmt.Sprintf("git@%s:%s.git", parts[0], parts[1])
 }
 
+// isInsecureURL reports whether rawURL is a plain http or file URL.
+func isInsecureURL(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "http://") || strings.HasPrefix(rawURL, "file://")
+}
+
+// urlToRepoPath converts a clone URL, e.g. git@github.com:bep/hugo.git,
+// back to a repo path, e.g. github.com/bep/hugo.
+func urlToRepoPath(rawURL string) (string, bool) {
+	var host, path string
+	if u, err := url.Parse(rawURL); err == nil && u.Scheme != "" && u.Host != "" {
+		host, path = u.Hostname(), u.Path
+	} else if userHost, p, found := strings.Cut(rawURL, ":"); found && !strings.Contains(userHost, "/") {
+		_, host, found = strings.Cut(userHost, "@")
+		if !found {
+			host = userHost
+		}
+		path = p
+	} else {
+		return "", false
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || !strings.Contains(path, "/") {
+		return "", false
+	}
+	return host + "/" + path, true
+}
+
 const (
 	gitignoreStart = "# Managed by gitjoin - do not edit this section"
 	gitignoreEnd   = "# End gitjoin managed section"
 )
 
-func (s *Syncer) updateGitignore(repos map[string]string) error {
-	gitignorePath := filepath.Join(s.Cfg.Root, ".gitignore")
+func validateGitignore(mode string) error {
+	switch mode {
+	case "", "off", "gitignore", "info-exclude":
+		return nil
+	}
+	return fmt.Errorf("invalid gitignore mode %q, must be off, gitignore or info-exclude", mode)
+}
+
+// updateManagedFiles updates the files in the root that list the managed
+// repos.
+func (s *Syncer) updateManagedFiles(managed map[string]entry) error {
+	if err := s.updateGitignore(managed); err != nil {
+		return fmt.Errorf("update .gitignore: %w", err)
+	}
+	if err := s.updateCodeWorkspace(managed, false); err != nil {
+		return fmt.Errorf("update %s: %w", codeWorkspaceFile, err)
+	}
+	if s.ws.GoWork {
+		if err := s.updateGoWork(managed); err != nil {
+			return fmt.Errorf("update go.work: %w", err)
+		}
+	}
+	return nil
+}
+
+// updateGitignore writes the managed block listing the repos to .gitignore
+// or .git/info/exclude in the root, depending on the gitignore setting.
+func (s *Syncer) updateGitignore(repos map[string]entry) error {
+	var gitignorePath string
+	switch cmp.Or(s.Cfg.Gitignore, s.ws.Gitignore) {
+	case "off":
+		return nil
+	case "info-exclude":
+		if !(Repo{Path: s.Cfg.Root}).IsGitRepo() {
+			return errors.New("gitignore info-exclude requires the root to be a git repo")
+		}
+		gitignorePath = filepath.Join(s.Cfg.Root, ".git", "info", "exclude")
+		if err := os.MkdirAll(filepath.Dir(gitignorePath), 0o755); err != nil {
+			return err
+		}
+	default:
+		gitignorePath = filepath.Join(s.Cfg.Root, ".gitignore")
+	}
+	if resolved, err := filepath.EvalSymlinks(gitignorePath); err == nil {
+		gitignorePath = resolved
+	}
 
 	var paths []string
 	for localPath := range repos {
 		paths = append(paths, filepath.ToSlash(localPath)+"/")
 	}
 	sort.Strings(paths)
+	// gitjoin's own state, never to be committed.
+	paths = append([]string{"/.gitjoin/"}, paths...)
 
-	var managed strings.Builder
-	managed.WriteString(gitignoreStart + "\n")
-	for _, p := range paths {
-		managed.WriteString(p + "\n")
+	perm := os.FileMode(0o644)
+	if fi, err := os.Stat(gitignorePath); err == nil {
+		perm = fi.Mode().Perm()
 	}
-	managed.WriteString(gitignoreEnd + "\n")
-
 	existing, err := os.ReadFile(gitignorePath)
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	content := string(existing)
+	nl := "\n"
+	if strings.Contains(content, "\r\n") {
+		nl = "\r\n"
+	}
+
+	var managed strings.Builder
+	managed.WriteString(gitignoreStart + nl)
+	for _, p := range paths {
+		managed.WriteString(p + nl)
+	}
+	managed.WriteString(gitignoreEnd + nl)
 
-	var newContent string
+	newContent, found := replaceBlock(content, gitignoreStart, gitignoreEnd, managed.String())
 	if len(existing) == 0 {
 		newContent = managed.String()
-	} else {
-		content := string(existing)
-		startIdx := strings.Index(content, gitignoreStart)
-		endIdx := strings.Index(content, gitignoreEnd)
-
-		if startIdx >= 0 && endIdx > startIdx {
-			endIdx += len(gitignoreEnd)
-			if endIdx < len(content) && content[endIdx] == '\n' {
-				endIdx++
-			}
-			newContent = content[:startIdx] + managed.String() + content[endIdx:]
-		} else {
-			if !strings.HasSuffix(content, "\n") {
-				content += "\n"
-			}
-			newContent = content + "\n" + managed.String()
+	} else if !found {
+		if !strings.HasSuffix(content, "\n") {
+			content += nl
 		}
+		newContent = content + nl + managed.String()
+	}
+
+	if newContent == string(existing) {
+		return nil
+	}
+	return writeFileAtomic(gitignorePath, []byte(newContent), perm)
+}
+
+// replaceBlock replaces the lines of content from the one containing start
+// to the one containing end with block, and reports whether they were
+// found.
+func replaceBlock(content, start, end, block string) (string, bool) {
+	startIdx := strings.Index(content, start)
+	endIdx := strings.Index(content, end)
+	if startIdx < 0 || endIdx < startIdx {
+		return content, false
+	}
+	startIdx = strings.LastIndex(content[:startIdx], "\n") + 1
+	endIdx += len(end)
+	if i := strings.Index(content[endIdx:], "\n"); i >= 0 {
+		endIdx += i + 1
+	} else {
+		endIdx = len(content)
 	}
+	return content[:startIdx] + block + content[endIdx:], true
+}
 
-	return os.WriteFile(gitignorePath, []byte(newContent), 0o644)
+// writeFileAtomic writes b to filename through a temporary file in the
+// same directory, so readers never see a partial file.
+func writeFileAtomic(filename string, b []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
 }
@@ -3,11 +3,177 @@
 
 package lib
 
+import "time"
+
 type Config struct {
-	Root  string
-	Force bool
-	Quiet bool
-	Paths string // glob filter (optional)
+	Root    string
+	Force   bool
+	Quiet   bool
+	Paths   []string // doublestar patterns for local or repo paths (optional)
+	Hosts   []string // e.g. github.com (optional)
+	Owners  []string // e.g. bep (optional)
+	Langs   []string // go, node, rust or python (optional)
+	Modules []string // doublestar patterns for Go modules or packages (optional)
+	Color   string   // auto, always or never
+	Filter  string   // partial clone filter, e.g. blob:none (optional)
+
+	// SingleBranch clones only the default branch of new repos, see the
+	// single-branch annotation.
+	SingleBranch bool
+
+	// Manifests are the gitjoin.txt files to use, relative to the root
+	// (optional). If not set, they're found below the root, at most
+	// MaxDepth directories down (0 means no limit).
+	Manifests []string
+	MaxDepth  int
+
+	// Disambiguate is how repos with the same name in a gitjoin.txt file
+	// get separate directories: owner (tool-a) or owner-dir (a/tool). If
+	// empty, they're an error.
+	Disambiguate string
+
+	// Run only one phase of the sync. The sweep of repos no longer
+	// in gitjoin.txt is skipped in both.
+	OnlyClone  bool
+	OnlyUpdate bool
+
+	// RemoveAnywhere removes git repos not in any gitjoin.txt anywhere
+	// below the root, not just in the directories with a gitjoin.txt and
+	// those of the repos listed in them.
+	RemoveAnywhere bool
+
+	// SummaryFile is an optional file to write a report of the sync to.
+	// SummaryFormat is md, json or github (Markdown appended to
+	// $GITHUB_STEP_SUMMARY by default). If empty, it's derived from the
+	// SummaryFile extension.
+	SummaryFile   string
+	SummaryFormat string
+
+	// PullRoot pulls the root, a git repo with the gitjoin.txt files,
+	// before reading them.
+	PullRoot bool
+
+	// Wait waits for another gitjoin syncing the root to finish instead
+	// of failing.
+	Wait bool
+
+	// ChangesOnly prints nothing, not even the profile, if nothing
+	// happened to any repo.
+	ChangesOnly bool
+
+	// PostSyncCmd is run with sh after every sync, with the result as
+	// JSON, like the json summary file, on stdin.
+	PostSyncCmd string
+
+	// Gitignore is where to list the managed repos: gitignore, info-exclude
+	// or off. Defaults to the workspace config, then gitignore.
+	Gitignore string
+
+	// Offline skips all network operations, reporting the repos that
+	// would be cloned, pulled or removed instead.
+	Offline bool
+
+	// Profile records the time spent per repo and prints the slowest.
+	Profile bool
+
+	// ResetDiverged hard resets a default branch that has diverged from
+	// origin when used with Force. The local commits are lost.
+	ResetDiverged bool
+
+	// Repair removes and re-clones the leftovers of interrupted clones.
+	Repair bool
+
+	// CheckArchived looks up the repos on GitHub and GitLab and skips
+	// those archived there instead of pulling them.
+	CheckArchived bool
+
+	// MaxStash is the number of changed files above which -force skips a
+	// repo instead of stashing its changes. 0 means no limit.
+	MaxStash int
+
+	// MaxFailures is the number of repos in a row failing for lack of
+	// credentials or network after which the sync stops. 0 means no limit.
+	MaxFailures int
+
+	// NoCache processes every repo fully, also those unchanged since the
+	// last sync.
+	NoCache bool
+
+	// Since looks up on GitHub or GitLab whether a repo has been pushed
+	// to since it was last fetched, and only fetches it if so.
+	Since bool
+
+	// FSMonitor enables core.fsmonitor, where supported, and
+	// core.untrackedCache in all repos, see the fsmonitor annotation.
+	FSMonitor bool
+
+	// FixManifest updates the gitjoin.txt entry and the origin URL of
+	// repos the remote redirects to a new location.
+	FixManifest bool
+
+	// AllowInsecure allows cloning over plain http and from file:// URLs.
+	AllowInsecure bool
+
+	// CloneJobs and PullJobs are the number of repos cloned and updated
+	// in parallel, in separate queues (0 means the default).
+	CloneJobs int
+	PullJobs  int
+
+	// Ordered lists the repos in the summary in the order of the
+	// gitjoin.txt files, and starts them in that order. With CloneJobs and
+	// PullJobs set to 1, the repos are processed one at a time.
+	Ordered bool
+
+	// MaxBandwidth limits the total throughput of clones and fetches over
+	// HTTP(S), in bytes per second (0 means no limit).
+	MaxBandwidth int64
+	limiter      *limiter // shared by all the roots synced
+
+	// GitBin is the git binary to use (optional, defaults to git).
+	GitBin string
+
+	// GitArgs are passed to every git invocation, e.g. -c key=value.
+	GitArgs []string
+
+	// Tokens are access tokens used for HTTPS by gitjoin's git commands,
+	// each given as HOST=TOKEN, or as TOKEN for github.com.
+	Tokens []string
+
+	// gitEnv is added to the environment of every git invocation.
+	gitEnv []string
+
+	// InteractiveAuth lets git prompt for credentials, processing one repo
+	// at a time. By default, git fails instead.
+	InteractiveAuth bool
+
+	// Events receives the outcome for each repo as it's processed (optional).
+	Events Events
+
+	// RenameBranches renames the local default branch when the remote default branch is renamed.
+	RenameBranches bool
+
+	// PruneBranches deletes merged local branches whose upstream is gone.
+	PruneBranches bool
+
+	// Tags fetches all tags from origin when pulling.
+	Tags bool
+
+	// VerifySignatures verifies the signature of HEAD after pulling and
+	// rolls back if it's not signed by an allowed signer.
+	VerifySignatures bool
+	AllowedSigners   string // SSH allowed signers file (optional)
+
+	// ManifestAllowedSigners and ManifestGPGKeyring are the keys every
+	// gitjoin.txt must be signed with, if set. They're never read from the
+	// root, which the manifests could be tampered with in.
+	ManifestAllowedSigners string // SSH allowed signers file
+	ManifestGPGKeyring     string // GPG keyring for gpgv
+
+	// Args is the command line, recorded in the history (optional).
+	Args []string
+
+	// GroupBy groups the summary by dir, manifest, host or owner (optional).
+	GroupBy string
 }
 
 type Result struct {
@@ -15,15 +181,65 @@ type Result struct {
 	Cloned  []RepoResult
 	Removed []string
 	Skipped []SkippedRepo
+	Failed  []FailedRepo
+
+	Repos    int   `json:",omitempty"` // processed
+	Received int64 `json:",omitempty"` // bytes of the packs received by clones
+
+	// Set when Config.Profile is enabled.
+	Duration time.Duration `json:",omitempty"`
+	Timings  []Timing      `json:",omitempty"`
+
+	entries map[string]entry // the managed repos by local path, used for grouping
+	removed []removedRepo    // recorded in the history
+}
+
+// Timing is the time spent processing a repo.
+type Timing struct {
+	Path string
+	Wall time.Duration
+	CPU  time.Duration // used by git
 }
 
 type RepoResult struct {
-	Path   string
-	Detail string
+	Path    string
+	Detail  string
+	Commits int `json:",omitempty"` // pulled
+
+	loc string // where the repo is defined, e.g. ws/gitjoin.txt:3
 }
 
+// Skip reasons.
+const (
+	reasonUncommitted = "uncommitted changes"
+	reasonNonDefault  = "non-default branch"
+	reasonDetached    = "detached HEAD"
+	reasonUnverified  = "unverified signature"
+	reasonDiverged    = "diverged"
+	reasonDisabled    = "disabled"
+	reasonFrozen      = "frozen"
+	reasonArchived    = "archived"
+	reasonOffline     = "offline"
+	reasonInProgress  = "operation in progress"
+	reasonManual      = "needs manual attention"
+)
+
 type SkippedRepo struct {
 	Path   string
 	Reason string
 	Detail string
+
+	// Location is where the repo is defined, e.g. ws/gitjoin.txt:3.
+	Location string `json:",omitempty"`
+}
+
+// FailedRepo is a repo that failed to sync. Stage is the step that
+// failed, e.g. clone or pull.
+type FailedRepo struct {
+	Path  string
+	Stage string
+	Err   string
+
+	// Location is where the repo is defined, e.g. ws/gitjoin.txt:3.
+	Location string `json:",omitempty"`
 }
@@ -0,0 +1,306 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+const uiHelp = "j/k: move  space: select  a: select all  s: sync  enter: details  l: log  q: quit"
+
+// UI runs an interactive terminal UI listing all managed repos. The
+// outcome of a sync started from it is shown as each repo is processed.
+func UI(cfg Config) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("ui requires a terminal")
+	}
+	if cfg.InteractiveAuth {
+		// git would prompt for credentials on top of the screen.
+		return errors.New("ui can't be used with -interactive-auth")
+	}
+
+	// Clone progress etc. would mess up the screen.
+	cfg.Quiet = true
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	s.color = useColor(cfg.Color, os.Stdout)
+
+	expected, err := s.collectExpectedRepos()
+	if err != nil {
+		return err
+	}
+	u := newUI(s, slices.Sorted(maps.Keys(expected)))
+	s.Cfg.Events = u
+	if err := u.refresh(u.paths); err != nil {
+		return err
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	w := os.Stdout
+	fmt.Fprint(w, "\033[?25l")
+	defer fmt.Fprint(w, "\033[?25h\033[H\033[2J")
+
+	keys, errc := make(chan string), make(chan error, 1)
+	go func() {
+		buf := make([]byte, 3)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				errc <- err
+				return
+			}
+			keys <- string(buf[:n])
+		}
+	}()
+
+	for {
+		_, height, err := term.GetSize(fd)
+		if err != nil {
+			height = 24
+		}
+		u.render(w, height)
+		select {
+		case key := <-keys:
+			if !u.handle(key) {
+				return nil
+			}
+		case <-u.changed:
+		case err := <-errc:
+			return err
+		}
+	}
+}
+
+type ui struct {
+	s       *Syncer
+	paths   []string
+	cursor  int
+	offset  int
+	changed chan struct{} // signalled when a sync changes the table
+
+	mu       sync.Mutex
+	selected map[string]bool
+	states   map[string]string // branch and state per repo
+	details  map[string]string // outcome of the last sync per repo
+	syncing  bool
+	message  string
+}
+
+func newUI(s *Syncer, paths []string) *ui {
+	return &ui{
+		s:        s,
+		paths:    paths,
+		changed:  make(chan struct{}, 1),
+		selected: make(map[string]bool),
+		states:   make(map[string]string),
+		details:  make(map[string]string),
+	}
+}
+
+// handle handles a key press, returning false to quit.
+func (u *ui) handle(key string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	current := ""
+	if len(u.paths) > 0 {
+		current = u.paths[u.cursor]
+	}
+	if current == "" && (key == " " || key == "\r" || key == "l") {
+		u.message = "No repos"
+		return true
+	}
+	switch key {
+	case "q", "\x03":
+		if u.syncing {
+			u.message = "Sync in progress, wait for it to finish"
+			return true
+		}
+		return false
+	case "j", "\x1b[B":
+		u.cursor = min(u.cursor+1, max(len(u.paths)-1, 0))
+	case "k", "\x1b[A":
+		u.cursor = max(u.cursor-1, 0)
+	case " ":
+		u.selected[current] = !u.selected[current]
+	case "a":
+		all := len(u.selection()) < len(u.paths)
+		for _, p := range u.paths {
+			u.selected[p] = all
+		}
+	case "s":
+		if u.syncing {
+			u.message = "Sync in progress"
+			return true
+		}
+		paths := u.selection()
+		if len(paths) == 0 && current != "" {
+			paths = []string{current}
+		}
+		if len(paths) == 0 {
+			u.message = "No repos"
+			return true
+		}
+		for _, p := range paths {
+			u.details[p] = "syncing"
+		}
+		u.syncing = true
+		u.message = fmt.Sprintf("Syncing %d repos...", len(paths))
+		go u.sync(paths)
+	case "\r":
+		detail := u.details[current]
+		if detail == "" {
+			detail = "not synced in this session"
+		}
+		u.message = current + ": " + detail
+	case "l":
+		out, err := u.s.repo(current).run("log", "--oneline", "-n", "10")
+		if err != nil {
+			u.message = err.Error()
+		} else {
+			u.message = strings.TrimSpace(out)
+		}
+	}
+	return true
+}
+
+// selection returns the selected repos in the order listed. The caller
+// must hold u.mu.
+func (u *ui) selection() []string {
+	var paths []string
+	for _, p := range u.paths {
+		if u.selected[p] {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+func (u *ui) refresh(paths []string) error {
+	for _, p := range paths {
+		branch, state, err := u.s.describe(p)
+		if err != nil {
+			return err
+		}
+		u.mu.Lock()
+		u.states[p] = strings.TrimSpace(branch + "  " + state)
+		u.mu.Unlock()
+	}
+	return nil
+}
+
+// sync syncs the repos at paths like gitjoin retry does, taking the lock
+// and saving the state, cache and history. The outcome of each repo
+// comes in through the Events methods as it's processed.
+func (u *ui) sync(paths []string) {
+	u.s.retry = make(map[string]bool)
+	for _, p := range paths {
+		u.s.retry[p] = true
+	}
+	result, err := u.s.syncRoot()
+	u.s.retry = nil
+	message := fmt.Sprintf("Synced %d repos: %d updated, %d cloned, %d skipped, %d failed",
+		len(paths), len(result.Updated), len(result.Cloned), len(result.Skipped), len(result.Failed))
+	if err != nil && !stoppedEarly(err) {
+		message = err.Error()
+	} else if err := u.refresh(paths); err != nil {
+		message = err.Error()
+	}
+	u.mu.Lock()
+	for _, p := range paths {
+		if u.details[p] == "syncing" {
+			u.details[p] = "up to date"
+		}
+	}
+	u.syncing = false
+	u.message = message
+	u.mu.Unlock()
+	u.notify()
+}
+
+// notify tells the UI loop to redraw, without blocking.
+func (u *ui) notify() {
+	select {
+	case u.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (u *ui) setDetail(path, detail string) {
+	u.mu.Lock()
+	u.details[path] = detail
+	u.mu.Unlock()
+	u.notify()
+}
+
+func (u *ui) OnClone(r RepoResult) { u.setDetail(r.Path, "cloned") }
+func (u *ui) OnPull(r RepoResult)  { u.setDetail(r.Path, "updated: "+r.Detail) }
+func (u *ui) OnSkip(r SkippedRepo) { u.setDetail(r.Path, "skipped: "+r.Reason+" ("+r.Detail+")") }
+func (u *ui) OnRemove(path string) {}
+func (u *ui) OnFail(r FailedRepo)  { u.setDetail(r.Path, "failed: "+r.Stage+": "+r.Err) }
+
+// render draws the table of repos and the message to w, fitting the
+// table to a terminal height rows tall.
+func (u *ui) render(w io.Writer, height int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	messageLines := strings.Split(u.message, "\n")
+	rows := max(height-len(messageLines)-3, 1)
+	if u.cursor < u.offset {
+		u.offset = u.cursor
+	} else if u.cursor >= u.offset+rows {
+		u.offset = u.cursor - rows + 1
+	}
+
+	width := 0
+	for _, p := range u.paths {
+		width = max(width, len(p))
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	b.WriteString(u.s.colorize(colorGreen, "gitjoin") + "  " + uiHelp + "\r\n\r\n")
+	for i := u.offset; i < min(u.offset+rows, len(u.paths)); i++ {
+		p := u.paths[i]
+		cursor, check := "  ", "[ ]"
+		if i == u.cursor {
+			cursor = "> "
+		}
+		if u.selected[p] {
+			check = "[x]"
+		}
+		state := u.states[p]
+		outcome, _, _ := strings.Cut(u.details[p], ":")
+		switch outcome {
+		case "skipped":
+			state = u.s.colorize(colorYellow, state)
+		case "failed":
+			outcome = u.s.colorize(colorRed, outcome)
+		case "cloned", "updated":
+			outcome = u.s.colorize(colorGreen, outcome)
+		}
+		fmt.Fprintf(&b, "%s%s %-*s  %s", cursor, check, width, p, state)
+		if outcome != "" {
+			b.WriteString("  " + outcome)
+		}
+		b.WriteString("\r\n")
+	}
+	b.WriteString("\r\n" + strings.Join(messageLines, "\r\n"))
+	io.WriteString(w, b.String())
+}
@@ -0,0 +1,77 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUISelection(t *testing.T) {
+	u := newUI(&Syncer{}, []string{"a", "b", "c"})
+	for _, key := range []string{"j", " ", "j", "j", " "} {
+		if !u.handle(key) {
+			t.Fatalf("quit on %q", key)
+		}
+	}
+	if got, want := u.selection(), []string{"b", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("selection: got %v, want %v", got, want)
+	}
+	u.handle("a")
+	if got := u.selection(); len(got) != 3 {
+		t.Fatalf("select all: got %v", got)
+	}
+	u.handle("a")
+	if got := u.selection(); len(got) != 0 {
+		t.Fatalf("deselect all: got %v", got)
+	}
+	if u.handle("q") {
+		t.Fatal("q didn't quit")
+	}
+
+	u.syncing = true
+	if !u.handle("q") || u.message != "Sync in progress, wait for it to finish" {
+		t.Fatalf("q while syncing: %q", u.message)
+	}
+}
+
+func TestUIRender(t *testing.T) {
+	u := newUI(&Syncer{}, []string{"ws/bar", "ws/foo", "ws/qux"})
+	u.states["ws/bar"] = "main  clean"
+	u.handle("j")
+	u.handle(" ")
+	u.OnPull(RepoResult{Path: "ws/foo", Detail: "2 commits"})
+	u.OnFail(FailedRepo{Path: "ws/qux", Stage: "fetch", Err: "boom"})
+
+	var b bytes.Buffer
+	u.render(&b, 24)
+	got := strings.Split(b.String(), "\r\n")
+	for i, want := range []string{
+		"  [ ] ws/bar  main  clean",
+		"> [x] ws/foo    updated",
+		"  [ ] ws/qux    failed",
+	} {
+		if got[i+2] != want {
+			t.Errorf("line %d: got %q, want %q", i+2, got[i+2], want)
+		}
+	}
+
+	// The table scrolls to keep the cursor in view.
+	u.handle("j")
+	b.Reset()
+	u.render(&b, 5)
+	if got := strings.Split(b.String(), "\r\n")[2]; got != "> [ ] ws/qux    failed" {
+		t.Errorf("scrolled: got %q", got)
+	}
+
+	u = newUI(&Syncer{}, nil)
+	u.handle("s")
+	b.Reset()
+	u.render(&b, 24)
+	if !strings.HasSuffix(b.String(), "\r\nNo repos") {
+		t.Errorf("no repos: got %q", b.String())
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// UndoRemove re-clones the repos removed by the last sync that removed
+// any, at the commit they were at, and adds them back to the gitjoin.txt
+// in their parent directory.
+func UndoRemove(cfg Config) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	runs, err := loadHistory(cfg.Root)
+	if err != nil {
+		return err
+	}
+	var last *record
+	for i := len(runs) - 1; i >= 0 && last == nil; i-- {
+		if len(runs[i].RemovedRepos) > 0 {
+			last = &runs[i]
+		}
+	}
+	if last == nil {
+		s.log("No removed repos to restore\n")
+		return nil
+	}
+	s.log("Restoring repos removed %s\n", last.Time.Local().Format(time.DateTime))
+
+	var restored, skipped, failed []RepoResult
+	for _, r := range last.RemovedRepos {
+		repo := s.repo(r.Path)
+		if _, err := os.Stat(repo.Path); err == nil {
+			skipped = append(skipped, RepoResult{Path: r.Path, Detail: "already exists"})
+			continue
+		}
+		repoPath, ok := urlToRepoPath(r.URL)
+		if !ok {
+			skipped = append(skipped, RepoResult{Path: r.Path, Detail: "unsupported URL " + r.URL})
+			continue
+		}
+		if filepath.Base(r.Path) != path.Base(repoPath) {
+			failed = append(failed, RepoResult{Path: r.Path, Detail: "directory name differs from " + repoPath})
+			continue
+		}
+		if _, err := repo.clone(r.URL, nil, s.out); err != nil {
+			failed = append(failed, RepoResult{Path: r.Path, Detail: err.Error()})
+			continue
+		}
+		if err := appendEntries(filepath.Join(cfg.Root, filepath.Dir(r.Path), "gitjoin.txt"), []string{manifestLine(repoPath, r.URL)}); err != nil {
+			return err
+		}
+		detail := repoPath
+		if head, _ := repo.Head(); head != r.Head && r.Head != "" {
+			if err := repo.ResetHard(r.Head); err != nil {
+				failed = append(failed, RepoResult{Path: r.Path, Detail: "reset to " + r.Head + ": " + strings.Join(strings.Fields(err.Error()), " ")})
+				continue
+			}
+			detail += ", reset to " + r.Head[:min(len(r.Head), 7)]
+		}
+		restored = append(restored, RepoResult{Path: r.Path, Detail: detail})
+	}
+
+	s.printSections(
+		section{colorGreen, "Restored", restored},
+		section{colorYellow, "Skipped", skipped},
+		section{colorRed, "Failed", failed},
+	)
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"sync"
+)
+
+type VerifyOptions struct {
+	Remote bool // check that the remotes can be reached
+	Fix    bool // normalize the gitjoin.txt files
+}
+
+// Verify checks the gitjoin.txt files for syntax errors, unknown
+// annotations, invalid repo paths, duplicate and nested local paths,
+// formatting, signatures and, optionally, unreachable remotes.
+func Verify(cfg Config, opts VerifyOptions) error {
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+	if opts.Fix {
+		unlock, err := s.lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	t, err := s.walk()
+	if err != nil {
+		return err
+	}
+	manifests, err := s.manifests(t)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	report := func(format string, a ...any) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+	repos := make(map[string]entry)
+	for _, manifest := range manifests {
+		changed, err := s.formatManifest(manifest, opts.Fix)
+		if err != nil {
+			return err
+		}
+		if changed && opts.Fix {
+			s.log("Fixed %s\n", manifest)
+		} else if changed {
+			report("%s: not formatted, run gitjoin verify -fix or gitjoin fmt", manifest)
+		}
+		if err := s.verifyManifest(manifest); err != nil {
+			report("%s", err)
+		}
+
+		entries, _, err := parseGitjoinFile(cfg.Root, manifest)
+		if errs, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, err := range errs.Unwrap() {
+				report("%s", err)
+			}
+		} else if err != nil {
+			report("%s", err)
+			continue
+		}
+		paths := localPaths(path.Dir(manifest), entries, s.Cfg.Disambiguate)
+		for i, e := range entries {
+			for _, a := range slices.Sorted(maps.Keys(e.Annotations)) {
+				if !slices.Contains(annotations, a) {
+					report("%s: unknown annotation %q", e.location(), a)
+				}
+			}
+			localPath := paths[i]
+			if prev, found := repos[localPath]; found {
+				report("%s: %s resolves to %s, as does %s (%s)", e.location(), e.Repo, localPath, prev.Repo, prev.location())
+				continue
+			}
+			repos[localPath] = e
+		}
+	}
+
+	localPaths := slices.Sorted(maps.Keys(repos))
+	for _, localPath := range localPaths {
+		for dir := path.Dir(localPath); dir != "."; dir = path.Dir(dir) {
+			if parent, found := repos[dir]; found {
+				report("%s: %s is nested inside %s (%s)", repos[localPath].location(), localPath, dir, parent.location())
+			}
+		}
+	}
+
+	if opts.Remote {
+		var (
+			mu          sync.Mutex
+			unreachable []string
+		)
+		err := s.forEachRepo(localPaths, func(localPath string) error {
+			e := repos[localPath]
+			url := s.ws.rewriteURL(repoPathToURL(e.Repo, e.protocol()))
+			if _, err := s.repo("").run("ls-remote", url, "HEAD"); err != nil {
+				msg := "can't be reached"
+				if isAuthError(err.Error()) {
+					msg = "requires authentication"
+				}
+				mu.Lock()
+				unreachable = append(unreachable, fmt.Sprintf("%s: %s %s", e.location(), url, msg))
+				mu.Unlock()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		slices.Sort(unreachable)
+		problems = append(problems, unreachable...)
+	}
+
+	for _, p := range problems {
+		s.log("%s\n", p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+	s.log("Verified %d gitjoin.txt files with %d repos\n", len(manifests), len(repos))
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// walkWorkers is the number of directories read in parallel.
+const walkWorkers = 16
+
+// tree is what's found below the root, with paths relative to it.
+type tree struct {
+	manifests []string // gitjoin.txt files
+	repos     []string // git repos, not including repos nested inside them
+}
+
+// walk finds the gitjoin.txt files and git repos below the root, reading
+// directories in parallel. It doesn't descend into repos (gitjoin.txt files
+// in clones are not ours to honor), nor more than Config.MaxDepth
+// directories down, apart from looking for repos one level further.
+func (s *Syncer) walk() (tree, error) {
+	var (
+		t     tree
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, walkWorkers)
+		errs  []error
+		visit func(dir string)
+	)
+	rel := func(p string) string {
+		r, _ := filepath.Rel(s.Cfg.Root, p)
+		return filepath.ToSlash(r)
+	}
+	visit = func(dir string) {
+		defer wg.Done()
+		sem <- struct{}{}
+		defer func() { <-sem }()
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+			return
+		}
+		for _, d := range entries {
+			p := filepath.Join(dir, d.Name())
+			switch {
+			case !d.IsDir():
+				if d.Name() == "gitjoin.txt" {
+					mu.Lock()
+					t.manifests = append(t.manifests, rel(p))
+					mu.Unlock()
+				}
+			case d.Name() == ".git", dir == s.Cfg.Root && d.Name() == ".gitjoin":
+			case (Repo{Path: p}).IsGitRepo():
+				mu.Lock()
+				t.repos = append(t.repos, rel(p))
+				mu.Unlock()
+			case !s.tooDeep(p):
+				wg.Add(1)
+				go visit(p)
+			}
+		}
+	}
+	wg.Add(1)
+	visit(s.Cfg.Root)
+	wg.Wait()
+	if len(errs) > 0 {
+		return t, errs[0]
+	}
+	slices.Sort(t.manifests)
+	slices.Sort(t.repos)
+	return t, nil
+}
+
+// manifests returns the gitjoin.txt files to use, relative to the root:
+// Config.Manifests if set, else the ones in t.
+func (s *Syncer) manifests(t tree) ([]string, error) {
+	if len(s.Cfg.Manifests) == 0 {
+		return t.manifests, nil
+	}
+	var manifests []string
+	for _, filename := range s.Cfg.Manifests {
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(s.Cfg.Root, filename)
+		}
+		rel, err := filepath.Rel(s.Cfg.Root, filename)
+		if err != nil {
+			return nil, err
+		}
+		if !filepath.IsLocal(rel) {
+			return nil, fmt.Errorf("manifest %s is outside of the root", filename)
+		}
+		manifests = append(manifests, filepath.ToSlash(rel))
+	}
+	return manifests, nil
+}
+
+// tooDeep reports whether dir is more than Config.MaxDepth directories
+// below the root.
+func (s *Syncer) tooDeep(dir string) bool {
+	if s.Cfg.MaxDepth == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(s.Cfg.Root, dir)
+	if err != nil || rel == "." {
+		return false
+	}
+	return strings.Count(rel, string(filepath.Separator))+1 > s.Cfg.MaxDepth
+}
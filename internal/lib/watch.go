@@ -0,0 +1,144 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type WatchOptions struct {
+	Interval time.Duration
+
+	// Optional Prometheus metrics, served on MetricsAddr (e.g. :9090)
+	// and/or written to MetricsFile for the node exporter's textfile collector.
+	MetricsAddr string
+	MetricsFile string
+
+	// Optional alerts about syncs with failed or removed repos, or repos
+	// needing manual attention: a JSON POST to a Slack-compatible webhook
+	// and/or an email sent through the SMTP server at SMTPAddr.
+	NotifyWebhook string
+	NotifyEmail   string
+	SMTPAddr      string
+}
+
+// Watch syncs repeatedly with the given interval until the process is stopped.
+func Watch(cfg Config, opts WatchOptions) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	if opts.Interval <= 0 {
+		return fmt.Errorf("invalid interval %s", opts.Interval)
+	}
+	s, err := newSyncer(cfg)
+	if err != nil {
+		return err
+	}
+
+	m := &metrics{}
+	n := newNotifier(opts)
+	if opts.MetricsAddr != "" {
+		ln, err := net.Listen("tcp", opts.MetricsAddr)
+		if err != nil {
+			return fmt.Errorf("metrics server: %w", err)
+		}
+		defer ln.Close()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m)
+		go http.Serve(ln, mux)
+	}
+
+	for {
+		start := time.Now()
+		result, err := s.sync()
+		if errors.Is(err, errInterrupted) {
+			return err
+		}
+		if err != nil {
+			s.log("error: %v\n", err)
+		}
+		m.update(result, err, len(result.entries), start, time.Since(start))
+		if err := n.notify(cfg.Root, result, err); err != nil {
+			s.log("error: notify: %v\n", err)
+		}
+		if opts.MetricsFile != "" {
+			if err := m.writeFile(opts.MetricsFile); err != nil {
+				s.log("error: write metrics: %v\n", err)
+			}
+		}
+		time.Sleep(opts.Interval)
+	}
+}
+
+// metrics holds the Prometheus metrics of the last sync.
+type metrics struct {
+	mu       sync.Mutex
+	last     time.Time
+	duration time.Duration
+	success  bool
+	total    int
+	result   Result
+}
+
+func (m *metrics) update(r Result, err error, total int, start time.Time, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last = start.Add(duration)
+	m.duration = duration
+	m.success = err == nil
+	m.total = total
+	m.result = r
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.last.IsZero() {
+		return
+	}
+	gauge := func(name, help string, value any) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+	success := 0
+	if m.success {
+		success = 1
+	}
+	gauge("gitjoin_last_sync_timestamp_seconds", "Unix time of the last completed sync.", m.last.Unix())
+	gauge("gitjoin_last_sync_success", "Whether the last sync succeeded.", success)
+	gauge("gitjoin_sync_duration_seconds", "Duration of the last sync.", m.duration.Seconds())
+	gauge("gitjoin_repos_total", "Number of managed repos.", m.total)
+	fmt.Fprintf(w, "# HELP gitjoin_repos Number of repos per outcome of the last sync.\n# TYPE gitjoin_repos gauge\n")
+	for _, v := range []struct {
+		state string
+		count int
+	}{
+		{"updated", len(m.result.Updated)},
+		{"cloned", len(m.result.Cloned)},
+		{"removed", len(m.result.Removed)},
+		{"skipped", len(m.result.Skipped)},
+		{"failed", len(m.result.Failed)},
+	} {
+		fmt.Fprintf(w, "gitjoin_repos{state=%q} %d\n", v.state, v.count)
+	}
+}
+
+// writeFile writes the metrics to filename atomically, so a collector
+// never reads a partial file.
+func (m *metrics) writeFile(filename string) error {
+	var b bytes.Buffer
+	m.write(&b)
+	return writeFileAtomic(filename, b.Bytes(), 0o644)
+}
@@ -0,0 +1,233 @@
+// Copyright 2026 Bjørn Erik Pedersen
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/pelletier/go-toml/v2"
+)
+
+const workspaceConfigFilename = "gitjoin.toml"
+
+// workspaceConfig is read from gitjoin.toml in the root, if present.
+type workspaceConfig struct {
+	// Rewrite maps clone URL prefixes to their replacements, e.g.
+	// "https://github.com/" = "https://mirror.example.com/github/".
+	Rewrite map[string]string `toml:"rewrite"`
+
+	// ReferenceStore is a directory for a bare repo shared by all clones
+	// as a reference, e.g. ~/.cache/gitjoin/objects.
+	ReferenceStore string `toml:"reference-store"`
+
+	// Gitignore is where to list the managed repos: gitignore (default),
+	// info-exclude or off.
+	Gitignore string `toml:"gitignore"`
+
+	// GoWork keeps a go.work in the root that uses every managed repo
+	// with a go.mod.
+	GoWork bool `toml:"go-work"`
+
+	// Config maps doublestar patterns for local or repo paths to git config
+	// settings applied to the matching repos, e.g.
+	// [config."github.com/corp/**"] "user.email" = "me@corp.com".
+	Config map[string]map[string]string `toml:"config"`
+
+	// Identities are the identities used for commits, each in the repos
+	// matching its paths or hosts, e.g. [identity.work].
+	Identities map[string]identity `toml:"identity"`
+
+	// FetchProfiles are fetch options for the repos matching their paths,
+	// e.g. [fetch-profile.bigrepo] for repos with huge histories.
+	FetchProfiles map[string]fetchProfile `toml:"fetch-profile"`
+
+	// HTTP maps hosts, e.g. github.com, to HTTP settings for them.
+	HTTP map[string]httpConfig `toml:"http"`
+}
+
+type identity struct {
+	Name       string `toml:"name"`
+	Email      string `toml:"email"`
+	SigningKey string `toml:"signingkey"`
+
+	Paths []string `toml:"paths"` // doublestar patterns for local or repo paths
+	Hosts []string `toml:"hosts"`
+}
+
+type fetchProfile struct {
+	// NegotiationAlgorithm is git's fetch.negotiationAlgorithm, e.g.
+	// skipping.
+	NegotiationAlgorithm string `toml:"negotiation-algorithm"`
+
+	// NegotiationTips limits the local refs reported to the remote,
+	// e.g. refs/remotes/origin/main.
+	NegotiationTips []string `toml:"negotiation-tips"`
+
+	Paths []string `toml:"paths"` // doublestar patterns for local or repo paths
+}
+
+type httpConfig struct {
+	// Proxy is the HTTP(S) proxy, empty to not use one, e.g. to bypass
+	// the proxy set in the environment.
+	Proxy *string `toml:"proxy"`
+
+	// SSLCAInfo is a file with the CA certificates to verify the host with.
+	SSLCAInfo string `toml:"ssl-ca-info"`
+}
+
+// httpArgs returns the git -c options for the HTTP settings, scoped to
+// each host with git's http.<url>.* config.
+func (wc workspaceConfig) httpArgs(root string) ([]string, error) {
+	var args []string
+	for _, host := range slices.Sorted(maps.Keys(wc.HTTP)) {
+		hc := wc.HTTP[host]
+		for _, scheme := range []string{"https", "http"} {
+			prefix := "http." + scheme + "://" + host + "/."
+			if hc.Proxy != nil {
+				args = append(args, "-c", prefix+"proxy="+*hc.Proxy)
+			}
+			if hc.SSLCAInfo != "" {
+				filename, err := expandPath(hc.SSLCAInfo, root)
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, "-c", prefix+"sslCAInfo="+filename)
+			}
+		}
+	}
+	return args, nil
+}
+
+func loadWorkspaceConfig(root string) (workspaceConfig, error) {
+	var wc workspaceConfig
+	b, err := os.ReadFile(filepath.Join(root, workspaceConfigFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return wc, nil
+		}
+		return wc, err
+	}
+	dec := toml.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&wc); err != nil {
+		var strictErr *toml.StrictMissingError
+		if errors.As(err, &strictErr) {
+			return wc, fmt.Errorf("%s: unknown fields:\n%s", workspaceConfigFilename, strictErr.String())
+		}
+		return wc, fmt.Errorf("%s: %w", workspaceConfigFilename, err)
+	}
+	if err := validateGitignore(wc.Gitignore); err != nil {
+		return wc, fmt.Errorf("%s: %w", workspaceConfigFilename, err)
+	}
+	for host := range wc.HTTP {
+		if host == "" || strings.ContainsAny(host, "/@") {
+			return wc, fmt.Errorf("%s: invalid http host %q, must be e.g. github.com", workspaceConfigFilename, host)
+		}
+	}
+	for pattern := range wc.Config {
+		if !doublestar.ValidatePattern(pattern) {
+			return wc, fmt.Errorf("%s: invalid config pattern %q", workspaceConfigFilename, pattern)
+		}
+	}
+	for name, id := range wc.Identities {
+		if len(id.Paths) == 0 && len(id.Hosts) == 0 {
+			return wc, fmt.Errorf("%s: identity %q needs paths or hosts", workspaceConfigFilename, name)
+		}
+		for _, pattern := range id.Paths {
+			if !doublestar.ValidatePattern(pattern) {
+				return wc, fmt.Errorf("%s: invalid pattern %q in identity %q", workspaceConfigFilename, pattern, name)
+			}
+		}
+	}
+	for name, fp := range wc.FetchProfiles {
+		if len(fp.Paths) == 0 {
+			return wc, fmt.Errorf("%s: fetch profile %q needs paths", workspaceConfigFilename, name)
+		}
+		for _, pattern := range fp.Paths {
+			if !doublestar.ValidatePattern(pattern) {
+				return wc, fmt.Errorf("%s: invalid pattern %q in fetch profile %q", workspaceConfigFilename, pattern, name)
+			}
+		}
+		switch fp.NegotiationAlgorithm {
+		case "", "consecutive", "skipping", "noop", "default":
+		default:
+			return wc, fmt.Errorf("%s: invalid negotiation-algorithm %q in fetch profile %q", workspaceConfigFilename, fp.NegotiationAlgorithm, name)
+		}
+	}
+	return wc, nil
+}
+
+// fetchProfile returns the fetch profile for the repo at localPath, or
+// the zero profile if it has none. Matching more than one is an error.
+func (wc workspaceConfig) fetchProfile(localPath, repoPath string) (fetchProfile, error) {
+	var name string
+	for _, n := range slices.Sorted(maps.Keys(wc.FetchProfiles)) {
+		matched, err := matchGlobs(wc.FetchProfiles[n].Paths, localPath, repoPath)
+		if err != nil {
+			return fetchProfile{}, err
+		}
+		if !matched {
+			continue
+		}
+		if name != "" {
+			return fetchProfile{}, fmt.Errorf("matches fetch profiles %q and %q", name, n)
+		}
+		name = n
+	}
+	return wc.FetchProfiles[name], nil
+}
+
+// identityConfig returns the git config for the identity of the repo at
+// localPath, or nil if it has none. Matching more than one identity is an
+// error, as either could be the wrong one.
+func (wc workspaceConfig) identityConfig(localPath, repoPath string) (map[string]string, error) {
+	host, _, _ := strings.Cut(repoPath, "/")
+	var name string
+	for _, n := range slices.Sorted(maps.Keys(wc.Identities)) {
+		matched, err := matchGlobs(wc.Identities[n].Paths, localPath, repoPath)
+		if err != nil {
+			return nil, err
+		}
+		if !matched && !slices.Contains(wc.Identities[n].Hosts, host) {
+			continue
+		}
+		if name != "" {
+			return nil, fmt.Errorf("matches identities %q and %q", name, n)
+		}
+		name = n
+	}
+	if name == "" {
+		return nil, nil
+	}
+	id := wc.Identities[name]
+	config := make(map[string]string)
+	for key, v := range map[string]string{"user.name": id.Name, "user.email": id.Email, "user.signingkey": id.SigningKey} {
+		if v != "" {
+			config[key] = v
+		}
+	}
+	return config, nil
+}
+
+// rewriteURL applies the longest matching rewrite prefix to url.
+func (wc workspaceConfig) rewriteURL(url string) string {
+	var from string
+	for prefix := range wc.Rewrite {
+		if strings.HasPrefix(url, prefix) && len(prefix) > len(from) {
+			from = prefix
+		}
+	}
+	if from == "" {
+		return url
+	}
+	return wc.Rewrite[from] + strings.TrimPrefix(url, from)
+}
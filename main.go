@@ -7,24 +7,44 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bep/gitjoin/internal/lib"
 )
 
 func main() {
-	if err := run(); err != nil {
+	if err := run(os.Args[1:]); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func run() error {
-	var cfg lib.Config
+func run(args []string) error {
+	cfg := lib.Config{Args: args}
+	command := "sync"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
 
-	flag.BoolVar(&cfg.Force, "force", false, "force sync: stash changes, switch to default branch")
-	flag.BoolVar(&cfg.Quiet, "quiet", false, "suppress all output")
-	flag.StringVar(&cfg.Paths, "paths", "", "glob filter for repo paths")
-	flag.Parse()
+	fs := flag.NewFlagSet("gitjoin "+command, flag.ExitOnError)
+	fs.BoolVar(&cfg.Quiet, "quiet", false, "suppress all output")
+	fs.Var((*listFlag)(&cfg.Paths), "paths", "filter repos by local or repo path, e.g. 'tools/**' or 'github.com/bep/*' (comma-separated, repeatable)")
+	fs.Var((*listFlag)(&cfg.Hosts), "host", "filter repos by host, e.g. gitlab.com (comma-separated, repeatable)")
+	fs.Var((*listFlag)(&cfg.Owners), "owner", "filter repos by owner or group, e.g. bep (comma-separated, repeatable)")
+	fs.Var((*listFlag)(&cfg.Langs), "lang", "filter cloned repos by language: go, node, rust or python (comma-separated, repeatable)")
+	fs.Var((*listFlag)(&cfg.Modules), "module", "filter cloned repos by Go module or package name, e.g. 'github.com/bep/**' (comma-separated, repeatable)")
+	fs.Var((*listFlag)(&cfg.Manifests), "manifest", "gitjoin.txt file to use instead of searching the root (comma-separated, repeatable)")
+	fs.IntVar(&cfg.MaxDepth, "max-depth", 0, "search for gitjoin.txt files at most this many directories below the root (default no limit)")
+	fs.StringVar(&cfg.Disambiguate, "disambiguate", "", "give repos with the same name their own directory by owner: owner (name-owner) or owner-dir (owner/name)")
+	fs.StringVar(&cfg.Color, "color", "auto", "colorize output: auto, always or never")
+	fs.StringVar(&cfg.GitBin, "git-bin", os.Getenv("GITJOIN_GIT_BIN"), "git binary to use")
+	gitArgs := fs.String("git-args", os.Getenv("GITJOIN_GIT_ARGS"), "extra arguments passed to every git command, e.g. '-c protocol.version=2'")
+	fs.Var((*listFlag)(&cfg.Tokens), "token", "access token for HTTPS as HOST=TOKEN, or TOKEN for github.com, used only by gitjoin (comma-separated, repeatable, default $GITJOIN_TOKEN)")
+	fs.StringVar(&cfg.ManifestAllowedSigners, "manifest-allowed-signers", os.Getenv("GITJOIN_MANIFEST_ALLOWED_SIGNERS"), "require every gitjoin.txt to be signed by a key in this SSH allowed signers file")
+	fs.StringVar(&cfg.ManifestGPGKeyring, "manifest-gpg-keyring", os.Getenv("GITJOIN_MANIFEST_GPG_KEYRING"), "require every gitjoin.txt to be signed by a key in this GPG keyring")
+	fs.BoolVar(&cfg.InteractiveAuth, "interactive-auth", false, "let git prompt for credentials, one repo at a time")
 
 	wd, err := os.Getwd()
 	if err != nil {
@@ -32,5 +52,371 @@ func run() error {
 	}
 	cfg.Root = wd
 
-	return lib.Sync(cfg)
+	// Positional arguments may be interleaved with flags.
+	var positional []string
+	parse := func() error {
+		for rest := args; ; rest = fs.Args()[1:] {
+			fs.Parse(rest)
+			if fs.NArg() == 0 {
+				break
+			}
+			positional = append(positional, fs.Arg(0))
+		}
+		cfg.GitArgs = strings.Fields(*gitArgs)
+		if len(cfg.Tokens) == 0 && os.Getenv("GITJOIN_TOKEN") != "" {
+			cfg.Tokens = strings.Split(os.Getenv("GITJOIN_TOKEN"), ",")
+		}
+		switch cfg.Color {
+		case "auto", "always", "never":
+			return nil
+		}
+		return fmt.Errorf("invalid -color %q", cfg.Color)
+	}
+
+	syncFlags := func() {
+		fs.BoolVar(&cfg.Force, "force", false, "force sync: stash changes, switch to default branch")
+		fs.BoolVar(&cfg.OnlyClone, "only-clone", false, "only clone missing repos")
+		fs.BoolVar(&cfg.OnlyUpdate, "only-update", false, "only update existing repos")
+		fs.BoolVar(&cfg.RemoveAnywhere, "remove-anywhere", false, "remove unlisted repos anywhere below the root, not just next to a gitjoin.txt")
+		fs.StringVar(&cfg.Gitignore, "gitignore", "", "where to list managed repos: gitignore, info-exclude or off (default gitignore)")
+		fs.BoolVar(&cfg.Offline, "offline", false, "skip network operations, report what would be done")
+		fs.StringVar(&cfg.SummaryFile, "summary-file", "", "write a report of the sync to this file")
+		fs.StringVar(&cfg.GroupBy, "group-by", "", "group the summary by dir, manifest, host or owner")
+		fs.StringVar(&cfg.SummaryFormat, "summary-format", "", "summary file format: md, json or github")
+		fs.BoolVar(&cfg.PullRoot, "pull-root", false, "pull the root repo first, to update the gitjoin.txt files in it")
+		fs.BoolVar(&cfg.Wait, "wait", false, "wait for another gitjoin syncing the root to finish instead of failing")
+		fs.StringVar(&cfg.PostSyncCmd, "post-sync-cmd", "", "command run with sh (cmd on Windows) after every sync, with the result as JSON on stdin")
+		fs.BoolVar(&cfg.Profile, "profile", false, "print the slowest repos and a time breakdown")
+		fs.BoolVar(&cfg.ChangesOnly, "changes-only", false, "print nothing if no repo was cloned, updated, removed, skipped or failed, e.g. for cron")
+		fs.BoolVar(&cfg.RenameBranches, "rename-branches", false, "rename the local default branch when renamed on the remote")
+		fs.BoolVar(&cfg.PruneBranches, "prune-branches", false, "delete merged local branches whose upstream is gone")
+		fs.BoolVar(&cfg.Tags, "tags", false, "fetch tags and report new ones")
+		fs.BoolVar(&cfg.VerifySignatures, "verify-signatures", false, "verify signature of pulled commits, roll back on failure")
+		fs.StringVar(&cfg.AllowedSigners, "allowed-signers", "", "SSH allowed signers file used with -verify-signatures")
+		fs.BoolVar(&cfg.ResetDiverged, "reset-diverged", false, "with -force, hard reset default branches that have diverged from origin")
+		fs.IntVar(&cfg.MaxStash, "max-stash", 50, "with -force, skip repos with more changed files than this instead of stashing (0 means no limit)")
+		fs.IntVar(&cfg.MaxFailures, "max-failures", 10, "stop after this many repos in a row failed for lack of credentials or network (0 means no limit)")
+		fs.BoolVar(&cfg.Repair, "repair", false, "remove and re-clone leftovers of interrupted clones")
+		fs.BoolVar(&cfg.CheckArchived, "check-archived", false, "skip repos archived on GitHub or GitLab (needs GITHUB_TOKEN or GITLAB_TOKEN)")
+		fs.BoolVar(&cfg.Since, "since", false, "only fetch repos pushed to since the last sync, per GitHub or GitLab (needs GITHUB_TOKEN or GITLAB_TOKEN)")
+		fs.BoolVar(&cfg.NoCache, "no-cache", false, "process every repo fully, also those unchanged since the last sync")
+		fs.BoolVar(&cfg.FSMonitor, "fsmonitor", false, "enable core.fsmonitor and core.untrackedCache in all repos for faster status checks")
+		fs.BoolVar(&cfg.FixManifest, "fix-manifest", false, "update gitjoin.txt entries and origin URLs of repos that moved")
+		fs.BoolVar(&cfg.AllowInsecure, "allow-insecure", false, "allow cloning over http and from file:// URLs")
+		fs.StringVar(&cfg.Filter, "filter", "", "partial clone filter for new clones, e.g. blob:none")
+		fs.BoolVar(&cfg.SingleBranch, "single-branch", false, "clone only the default branch of new repos")
+		fs.Var((*bandwidthFlag)(&cfg.MaxBandwidth), "max-bandwidth", "limit the total throughput of clones and fetches over HTTP(S), e.g. 5MB/s; SSH remotes aren't throttled")
+		fs.IntVar(&cfg.CloneJobs, "clone-jobs", 0, "number of repos to clone in parallel (default max(4, CPUs))")
+		fs.IntVar(&cfg.PullJobs, "pull-jobs", 0, "number of repos to update in parallel (default max(4, CPUs))")
+		fs.BoolVar(&cfg.Ordered, "ordered", false, "list and start repos in gitjoin.txt order; with -clone-jobs 1 -pull-jobs 1, process one at a time")
+	}
+
+	switch command {
+	case "sync":
+		syncFlags()
+		if err := parse(); err != nil {
+			return err
+		}
+		if len(positional) == 1 {
+			if found, err := lib.SyncRepo(cfg, positional[0]); found || err != nil {
+				return err
+			}
+		}
+		if len(positional) > 0 {
+			return lib.SyncRoots(cfg, positional)
+		}
+		return lib.Sync(cfg)
+	case "plan":
+		syncFlags()
+		asJSON := fs.Bool("json", false, "print the plan as JSON")
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.ShowPlan(cfg, *asJSON)
+	case "apply":
+		syncFlags()
+		if err := parse(); err != nil {
+			return err
+		}
+		if len(positional) > 1 {
+			return fmt.Errorf("usage: gitjoin apply [planfile]")
+		}
+		var plan lib.SyncPlan
+		if len(positional) == 1 {
+			plan, err = lib.LoadPlan(positional[0])
+		} else {
+			plan, err = lib.Plan(cfg)
+		}
+		if err != nil {
+			return err
+		}
+		return lib.Apply(cfg, plan)
+	case "retry":
+		syncFlags()
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.Retry(cfg)
+	case "branch":
+		if err := parse(); err != nil {
+			return err
+		}
+		if len(positional) != 2 || positional[0] != "create" {
+			return fmt.Errorf("usage: gitjoin branch create <branch>")
+		}
+		return lib.CreateBranch(cfg, positional[1])
+	case "switch":
+		if err := parse(); err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: gitjoin switch <branch|default>")
+		}
+		return lib.Switch(cfg, positional[0])
+	case "clean":
+		var opts lib.CleanOptions
+		fs.BoolVar(&opts.X, "x", false, "also remove files ignored by git")
+		fs.BoolVar(&opts.Yes, "yes", false, "don't ask for confirmation")
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.Clean(cfg, opts)
+	case "commit":
+		var opts lib.CommitOptions
+		fs.StringVar(&opts.Message, "m", "", "commit message")
+		fs.BoolVar(&opts.All, "all", false, "also commit untracked files")
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.Commit(cfg, opts)
+	case "diff":
+		var opts lib.DiffOptions
+		fs.BoolVar(&opts.Stat, "stat", false, "print a diffstat instead of the patch")
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.Diff(cfg, opts)
+	case "init":
+		syncFlags()
+		template := fs.String("template", "", "directory or git repo URL with the gitjoin.txt files to start from")
+		if err := parse(); err != nil {
+			return err
+		}
+		if *template == "" {
+			return fmt.Errorf("usage: gitjoin init -template <url-or-path>")
+		}
+		return lib.Init(cfg, *template)
+	case "workspace":
+		format := fs.String("format", "vscode", "editor to set up the workspace for: vscode or zed")
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.EditorWorkspace(cfg, *format)
+	case "each-changed":
+		if err := parse(); err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: gitjoin each-changed '<command>'")
+		}
+		return lib.EachChanged(cfg, positional[0])
+	case "list":
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.List(cfg)
+	case "log":
+		n := fs.Int("n", 10, "number of runs to show")
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.Log(cfg, *n)
+	case "freeze", "unfreeze":
+		if err := parse(); err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: gitjoin %s <repo>", command)
+		}
+		if command == "freeze" {
+			return lib.Freeze(cfg, positional[0])
+		}
+		return lib.Unfreeze(cfg, positional[0])
+	case "fmt":
+		check := fs.Bool("check", false, "list the files that need formatting, fail if any")
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.Fmt(cfg, *check)
+	case "import":
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.Import(cfg)
+	case "migrate":
+		var opts lib.MigrateOptions
+		fs.StringVar(&opts.From, "from", "", "tool to migrate from: repo-manifest, gita, myrepos, vcstool or git-workspace (default detected)")
+		if err := parse(); err != nil {
+			return err
+		}
+		if len(positional) > 1 {
+			return fmt.Errorf("usage: gitjoin migrate [-from <tool>] [file]")
+		}
+		if len(positional) == 1 {
+			opts.File = positional[0]
+		}
+		return lib.Migrate(cfg, opts)
+	case "open":
+		print := fs.Bool("print", false, "print the URL instead of opening it")
+		if err := parse(); err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: gitjoin open [-print] <repo>")
+		}
+		return lib.Open(cfg, positional[0], *print)
+	case "path":
+		if err := parse(); err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: gitjoin path <query>")
+		}
+		return lib.Path(cfg, positional[0])
+	case "pr":
+		var opts lib.PROptions
+		fs.StringVar(&opts.Title, "title", "", "pull request title")
+		fs.StringVar(&opts.Body, "body", "", "pull request description")
+		if err := parse(); err != nil {
+			return err
+		}
+		if len(positional) != 1 || positional[0] != "create" {
+			return fmt.Errorf("usage: gitjoin pr create -title <title> [-body <body>]")
+		}
+		return lib.CreatePRs(cfg, opts)
+	case "push":
+		var opts lib.PushOptions
+		fs.BoolVar(&opts.DryRun, "dry-run", false, "only show what would be pushed")
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.Push(cfg, opts)
+	case "stashes":
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.Stashes(cfg)
+	case "unstash":
+		if err := parse(); err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: gitjoin unstash <repo>")
+		}
+		return lib.Unstash(cfg, positional[0])
+	case "status":
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.Status(cfg)
+	case "stats":
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.Stats(cfg)
+	case "watch":
+		syncFlags()
+		var opts lib.WatchOptions
+		fs.DurationVar(&opts.Interval, "interval", 5*time.Minute, "time between syncs")
+		fs.StringVar(&opts.MetricsAddr, "metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9090")
+		fs.StringVar(&opts.MetricsFile, "metrics-file", "", "write Prometheus metrics to this file")
+		fs.StringVar(&opts.NotifyWebhook, "notify-webhook", "", "POST a JSON alert to this Slack-compatible webhook when repos fail, are removed or need attention")
+		fs.StringVar(&opts.NotifyEmail, "notify-email", "", "email an alert to this address when repos fail, are removed or need attention")
+		fs.StringVar(&opts.SMTPAddr, "smtp-addr", "localhost:25", "SMTP server for -notify-email, using SMTP_USERNAME and SMTP_PASSWORD if set")
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.Watch(cfg, opts)
+	case "completion":
+		if err := parse(); err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: gitjoin completion bash|zsh|fish|powershell")
+		}
+		return writeCompletion(os.Stdout, positional[0])
+	case "__complete":
+		// Used by the completion scripts.
+		if err := parse(); err != nil {
+			return err
+		}
+		if len(positional) != 1 || positional[0] != "repos" {
+			return fmt.Errorf("usage: gitjoin __complete repos")
+		}
+		paths, err := lib.RepoPaths(cfg)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			fmt.Println(p)
+		}
+		return nil
+	case "undo-remove":
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.UndoRemove(cfg)
+	case "verify":
+		var opts lib.VerifyOptions
+		fs.BoolVar(&opts.Remote, "remote", false, "check that the remotes can be reached")
+		fs.BoolVar(&opts.Fix, "fix", false, "sort, deduplicate and normalize the gitjoin.txt files")
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.Verify(cfg, opts)
+	case "ui":
+		if err := parse(); err != nil {
+			return err
+		}
+		return lib.UI(cfg)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// bandwidthFlag is a number of bytes per second, e.g. 5MB/s or 500KB.
+type bandwidthFlag int64
+
+func (f *bandwidthFlag) String() string {
+	return strconv.FormatInt(int64(*f), 10)
+}
+
+func (f *bandwidthFlag) Set(v string) error {
+	s := strings.ToUpper(strings.TrimSuffix(v, "/s"))
+	mult := int64(1)
+	for i, unit := range []string{"KB", "MB", "GB"} {
+		if rest, found := strings.CutSuffix(s, unit); found {
+			s, mult = rest, 1<<(10*(i+1))
+			break
+		}
+	}
+	s = strings.TrimSuffix(s, "B")
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid bandwidth %q, must be e.g. 5MB/s", v)
+	}
+	*f = bandwidthFlag(n * float64(mult))
+	return nil
+}
+
+// listFlag is a repeatable flag with comma-separated values.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(v string) error {
+	*f = append(*f, strings.Split(v, ",")...)
+	return nil
 }
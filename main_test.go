@@ -5,12 +5,22 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bep/helpers/envhelpers"
 	"github.com/rogpeppe/go-internal/testscript"
@@ -38,9 +48,45 @@ func testSetupFunc() func(env *testscript.Env) error {
 		// Add some environment variables to the test script.
 		keyVals = append(keyVals, "SOURCE", sourceDir)
 		keyVals = append(keyVals, "GITHUB_ACTIONS", fmt.Sprintf("%v", isGitHubActions))
+		// The host and a pid that's running, for lock files.
+		host, _ := os.Hostname()
+		keyVals = append(keyVals, "HOST", host, "PID", strconv.Itoa(os.Getpid()))
+		// Route example.com to local bare repositories created with mkremote.
+		gitconfig := filepath.Join(env.WorkDir, ".gitconfig")
+		keyVals = append(keyVals, "GIT_CONFIG_GLOBAL", gitconfig, "GIT_CONFIG_NOSYSTEM", "1")
 		envhelpers.SetEnvVars(&env.Vars, keyVals...)
 
-		return nil
+		return os.WriteFile(gitconfig, []byte(testGitConfig(env.WorkDir)), 0o644)
+	}
+}
+
+func testGitConfig(workDir string) string {
+	remotes := filepath.ToSlash(filepath.Join(workDir, "remotes"))
+	if !strings.HasPrefix(remotes, "/") {
+		remotes = "/" + remotes
+	}
+	return fmt.Sprintf(`[user]
+	name = gitjoin
+	email = gitjoin@example.com
+[init]
+	defaultBranch = main
+[protocol "file"]
+	allow = always
+[uploadpack]
+	allowFilter = true
+[url "file://%s/"]
+	insteadOf = https://example.com/
+	insteadOf = http://example.com/
+	insteadOf = git@example.com:
+`, remotes)
+}
+
+func testGit(ts *testscript.TestScript, dir string, args ...string) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL="+ts.Getenv("GIT_CONFIG_GLOBAL"), "GIT_CONFIG_NOSYSTEM=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		ts.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
 	}
 }
 
@@ -102,6 +148,149 @@ var commonTestScriptsParam = testscript.Params{
 				ts.Fatalf("%v", err)
 			}
 		},
+		// fakegithub starts a fake GitHub API that records created pull
+		// requests to pulls.txt, and points GITHUB_API_URL to it.
+		// A second pull request for the same head fails. The repos listed
+		// in archived.txt are reported as archived, those in pushed.txt as
+		// pushed to at the given time.
+		"fakegithub": func(ts *testscript.TestScript, neg bool, args []string) {
+			var mu sync.Mutex
+			seen := make(map[string]bool)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ownerRepo, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/repos/"), "/pulls")
+				if r.Method == "GET" && !ok && r.Header.Get("Authorization") == "Bearer "+ts.Getenv("GITHUB_TOKEN") {
+					archived, _ := os.ReadFile(ts.MkAbs("archived.txt"))
+					repo := map[string]any{"archived": slices.Contains(strings.Fields(string(archived)), ownerRepo)}
+					pushed, _ := os.ReadFile(ts.MkAbs("pushed.txt"))
+					for line := range strings.Lines(string(pushed)) {
+						if name, t, ok := strings.Cut(strings.TrimSpace(line), " "); ok && name == ownerRepo {
+							repo["pushed_at"] = t
+						}
+					}
+					json.NewEncoder(w).Encode(repo)
+					return
+				}
+				if r.Method != "POST" || !ok || r.Header.Get("Authorization") != "Bearer "+ts.Getenv("GITHUB_TOKEN") {
+					http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+					return
+				}
+				var pr struct{ Title, Head, Base string }
+				if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
+					http.Error(w, `{"message":"Bad Request"}`, http.StatusBadRequest)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				key := ownerRepo + ":" + pr.Head
+				if seen[key] {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+					fmt.Fprintf(w, `{"message":"Validation Failed","errors":[{"message":"A pull request already exists for %s."}]}`, key)
+					return
+				}
+				seen[key] = true
+				f, err := os.OpenFile(ts.MkAbs("pulls.txt"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+				if err == nil {
+					fmt.Fprintf(f, "%s %s->%s %s\n", ownerRepo, pr.Head, pr.Base, pr.Title)
+					f.Close()
+				}
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprintf(w, `{"html_url":"https://github.com/%s/pull/1"}`, ownerRepo)
+			}))
+			ts.Defer(srv.Close)
+			ts.Setenv("GITHUB_API_URL", srv.URL)
+		},
+		// authserver starts a git HTTP server that requires credentials
+		// for everything, and sets AUTH_URL to it and AUTH_HOST to its host. With a TOKEN, requests
+		// with it as the password are served the remotes created with
+		// mkremote.
+		"authserver": func(ts *testscript.TestScript, neg bool, args []string) {
+			var files http.Handler
+			if len(args) > 0 {
+				files = remotesHandler(ts)
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, password, ok := r.BasicAuth(); ok && files != nil && password == args[0] {
+					files.ServeHTTP(w, r)
+					return
+				}
+				w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			}))
+			ts.Defer(srv.Close)
+			ts.Setenv("AUTH_URL", srv.URL)
+			ts.Setenv("AUTH_HOST", strings.TrimPrefix(srv.URL, "http://"))
+		},
+		// webhook starts a server that appends the body of each request
+		// to webhook.log and sets WEBHOOK_URL to its URL.
+		"webhook": func(ts *testscript.TestScript, neg bool, args []string) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				f, err := os.OpenFile(ts.MkAbs("webhook.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+				if err == nil {
+					fmt.Fprintf(f, "%s\n", b)
+					f.Close()
+				}
+			}))
+			ts.Defer(srv.Close)
+			ts.Setenv("WEBHOOK_URL", srv.URL)
+		},
+		// httpremotes serves the remotes created with mkremote over git's
+		// dumb HTTP protocol, sets HTTP_REMOTES to the host of the server,
+		// and logs the Via header of each request to via.log. Arguments
+		// of the form OLD=NEW, e.g. old/foo=bep/foo, redirect OLD to NEW.
+		"httpremotes": func(ts *testscript.TestScript, neg bool, args []string) {
+			redirects := make(map[string]string)
+			for _, arg := range args {
+				from, to, ok := strings.Cut(arg, "=")
+				if !ok {
+					ts.Fatalf("usage: httpremotes [OLD=NEW...]")
+				}
+				redirects["/"+from+".git/"] = "/" + to + ".git/"
+			}
+			files := remotesHandler(ts)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				f, err := os.OpenFile(ts.MkAbs("via.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+				if err == nil {
+					fmt.Fprintf(f, "%s %s\n", r.URL.Path, r.Header.Get("Via"))
+					f.Close()
+				}
+				for from, to := range redirects {
+					if rest, ok := strings.CutPrefix(r.URL.Path, from); ok {
+						u := *r.URL
+						u.Path = to + rest
+						http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+						return
+					}
+				}
+				files.ServeHTTP(w, r)
+			}))
+			ts.Defer(srv.Close)
+			ts.Setenv("HTTP_REMOTES", strings.TrimPrefix(srv.URL, "http://"))
+		},
+		// httpproxy starts an HTTP proxy for plain http requests, logs
+		// the path of each to proxy.log and sets PROXY_URL to it.
+		"httpproxy": func(ts *testscript.TestScript, neg bool, args []string) {
+			tr := &http.Transport{}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				f, err := os.OpenFile(ts.MkAbs("proxy.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+				if err == nil {
+					fmt.Fprintf(f, "%s\n", r.URL.Path)
+					f.Close()
+				}
+				r.RequestURI = ""
+				resp, err := tr.RoundTrip(r)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadGateway)
+					return
+				}
+				defer resp.Body.Close()
+				maps.Copy(w.Header(), resp.Header)
+				w.WriteHeader(resp.StatusCode)
+				io.Copy(w, resp.Body)
+			}))
+			ts.Defer(srv.Close)
+			ts.Setenv("PROXY_URL", srv.URL)
+		},
 		// append appends to a file with a leading newline.
 		"append": func(ts *testscript.TestScript, neg bool, args []string) {
 			if len(args) < 2 {
@@ -134,6 +323,41 @@ var commonTestScriptsParam = testscript.Params{
 				ts.Fatalf("failed to write to file: %v", err)
 			}
 		},
+		// writefile writes TEXT and a newline to FILE.
+		"writefile": func(ts *testscript.TestScript, neg bool, args []string) {
+			if len(args) < 2 {
+				ts.Fatalf("usage: writefile FILE TEXT")
+			}
+			ts.Check(os.WriteFile(ts.MkAbs(args[0]), []byte(strings.Join(args[1:], " ")+"\n"), 0o644))
+		},
+		// sleep sleeps for DURATION, e.g. 1.5s.
+		"sleep": func(ts *testscript.TestScript, neg bool, args []string) {
+			if len(args) != 1 {
+				ts.Fatalf("usage: sleep DURATION")
+			}
+			d, err := time.ParseDuration(args[0])
+			ts.Check(err)
+			time.Sleep(d)
+		},
+		// mkremote creates a bare repository for example.com/OWNER/NAME with an initial commit.
+		"mkremote": func(ts *testscript.TestScript, neg bool, args []string) {
+			if len(args) != 1 {
+				ts.Fatalf("usage: mkremote OWNER/NAME")
+			}
+			bare := ts.MkAbs(filepath.Join("remotes", args[0]+".git"))
+			if err := os.MkdirAll(bare, 0o755); err != nil {
+				ts.Fatalf("%v", err)
+			}
+			testGit(ts, bare, "init", "--bare")
+			pushRemote(ts, args[0], "README.md", args[0])
+		},
+		// pushremote commits FILE with TEXT to the remote created with mkremote.
+		"pushremote": func(ts *testscript.TestScript, neg bool, args []string) {
+			if len(args) < 3 {
+				ts.Fatalf("usage: pushremote OWNER/NAME FILE TEXT")
+			}
+			pushRemote(ts, args[0], args[1], strings.Join(args[2:], " "))
+		},
 		// dostounix converts \r\n to \n.
 		"dostounix": func(ts *testscript.TestScript, neg bool, args []string) {
 			filename := ts.MkAbs(args[0])
@@ -146,5 +370,54 @@ var commonTestScriptsParam = testscript.Params{
 				ts.Fatalf("%v", err)
 			}
 		},
+		// unixtodos converts \n to \r\n.
+		"unixtodos": func(ts *testscript.TestScript, neg bool, args []string) {
+			filename := ts.MkAbs(args[0])
+			b, err := os.ReadFile(filename)
+			if err != nil {
+				ts.Fatalf("%v", err)
+			}
+			b = bytes.ReplaceAll(b, []byte{'\n'}, []byte("\r\n"))
+			if err := os.WriteFile(filename, b, 0o666); err != nil {
+				ts.Fatalf("%v", err)
+			}
+		},
 	},
 }
+
+// remotesHandler serves the remotes created with mkremote over git's dumb
+// HTTP protocol.
+func remotesHandler(ts *testscript.TestScript) http.Handler {
+	remotes := ts.MkAbs("remotes")
+	err := filepath.WalkDir(remotes, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || !strings.HasSuffix(path, ".git") {
+			return err
+		}
+		testGit(ts, path, "update-server-info")
+		return filepath.SkipDir
+	})
+	if err != nil {
+		ts.Fatalf("%v", err)
+	}
+	return http.FileServer(http.Dir(remotes))
+}
+
+func pushRemote(ts *testscript.TestScript, name, filename, text string) {
+	bare := ts.MkAbs(filepath.Join("remotes", name+".git"))
+	dir, err := os.MkdirTemp("", "gitjoin-remote")
+	if err != nil {
+		ts.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	testGit(ts, dir, "clone", bare, ".")
+	filename = filepath.Join(dir, filename)
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		ts.Fatalf("%v", err)
+	}
+	if err := os.WriteFile(filename, []byte(text+"\n"), 0o644); err != nil {
+		ts.Fatalf("%v", err)
+	}
+	testGit(ts, dir, "add", "-A")
+	testGit(ts, dir, "commit", "-m", "Update "+filename)
+	testGit(ts, dir, "push", "origin", "HEAD")
+}